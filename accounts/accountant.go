@@ -1,14 +1,82 @@
 package accounts
 
 import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+
 	sq "github.com/Masterminds/squirrel"
+	"github.com/concourse/concourse/atc/db"
+	corev1 "k8s.io/api/core/v1"
 )
 
+// ContainerTypeUnaccounted is the type of containers which are on a worker,
+// but which the database has no workload for.
+const ContainerTypeUnaccounted db.ContainerType = "unaccounted"
+
 type AccountantFactory func(Command) (Accountant, error)
 
 var DefaultAccountantFactory = func(cmd Command) (Accountant, error) {
-	var opener PostgresOpener
-	if cmd.WebK8sNamespace != "" && cmd.WebK8sPod != "" {
+	opener, err := postgresOpener(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var accountant Accountant = &DBAccountant{
+		Opener: opener,
+		Filter: WorkloadFilter{
+			Teams:     cmd.Teams,
+			Pipelines: cmd.Pipelines,
+		},
+		// containers missing from a worker may well have lost their
+		// workloads too
+		IncludeUnknown: cmd.IncludeUnknown || cmd.Subcommand == "missing",
+	}
+	if cmd.Subcommand == "missing" {
+		worker := cmd.MissingWorker
+		if worker == "" {
+			worker = cmd.WorkerName
+		}
+		return &MissingAccountant{
+			Accountant: accountant,
+			Opener:     opener,
+			Worker:     worker,
+		}, nil
+	}
+	if cmd.Disk {
+		dialer, err := workerDialer(cmd)
+		if err != nil {
+			return nil, err
+		}
+		accountant = &VolumeAccountant{
+			Accountant: accountant,
+			Opener:     opener,
+			Volumes:    &GardenVolumes{Dialer: dialer},
+		}
+	}
+	return accountant, nil
+}
+
+func postgresOpener(cmd Command) (PostgresOpener, error) {
+	if cmd.BoshDeployment != "" && cmd.BoshWebInstance != "" {
+		instance, err := ParseBoshInstance(cmd.BoshDeployment, cmd.BoshWebInstance, cmd.BoshNetwork)
+		if err != nil {
+			return nil, err
+		}
+		gateway, config, err := boshSSH(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &WebNodeInferredPostgresOpener{
+			WebNode: &BoshWebNode{
+				Runner: &SSHCommandRunner{
+					Hops: boshHops(gateway, instance, config),
+				},
+			},
+			FileTracker: &TmpfsTracker{},
+		}, nil
+	}
+	if webK8s(cmd) {
 		restConfig, err := RESTConfig()
 		if err != nil {
 			return nil, err
@@ -17,22 +85,87 @@ var DefaultAccountantFactory = func(cmd Command) (Accountant, error) {
 			RESTConfig: restConfig,
 			Namespace:  cmd.WebK8sNamespace,
 		}
-		pod, err := k8sClient.GetPod(cmd.WebK8sPod)
+		pod, err := webK8sPod(cmd, k8sClient)
 		if err != nil {
 			return nil, err
 		}
-		opener = &WebNodeInferredPostgresOpener{
-			WebNode: &K8sWebPod{Pod: pod, Client: k8sClient},
+		return &WebNodeInferredPostgresOpener{
+			WebNode: &K8sWebPod{
+				Pod:       pod,
+				Client:    k8sClient,
+				Container: cmd.WebContainer,
+			},
 			FileTracker: &TmpfsTracker{},
+			Dialer: &K8sPostgresDialer{
+				RESTConfig: restConfig,
+				Namespace:  cmd.WebK8sNamespace,
+			},
+		}, nil
+	}
+	if cmd.WebDockerContainer != "" {
+		return &WebNodeInferredPostgresOpener{
+			WebNode: &DockerWebContainer{
+				Socket:    cmd.DockerSocket,
+				Container: cmd.WebDockerContainer,
+			},
+			FileTracker: &TmpfsTracker{},
+		}, nil
+	}
+	if cmd.WebEnvFile != "" || cmd.WebPID != 0 {
+		return &WebNodeInferredPostgresOpener{
+			WebNode:     &LocalWebNode{EnvFile: cmd.WebEnvFile, PID: cmd.WebPID},
+			FileTracker: &TmpfsTracker{},
+		}, nil
+	}
+	return &StaticPostgresOpener{cmd.Postgres}, nil
+}
+
+// webK8s is whether the web node is a Kubernetes pod, given by name or found
+// through the workload running it.
+func webK8s(cmd Command) bool {
+	return cmd.WebK8sNamespace != "" &&
+		(cmd.WebK8sPod != "" || cmd.WebK8sDeployment != "" || cmd.HelmRelease != "")
+}
+
+func webK8sPod(cmd Command, client K8sClient) (*corev1.Pod, error) {
+	if cmd.WebK8sPod != "" {
+		return client.GetPod(cmd.WebK8sPod)
+	}
+	if cmd.WebK8sDeployment != "" {
+		workload, err := ParseK8sWebWorkload(cmd.WebK8sDeployment)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		opener = &StaticPostgresOpener{cmd.Postgres}
+		return FindWebPod(client, &workload, "", cmd.WebContainer)
 	}
-	return &DBAccountant{Opener: opener}, nil
+	return FindWebPod(client, nil, cmd.HelmRelease, cmd.WebContainer)
+}
+
+func webK8sPods(cmd Command, client K8sClient) ([]corev1.Pod, error) {
+	if cmd.WebK8sPod != "" {
+		pod, err := client.GetPod(cmd.WebK8sPod)
+		if err != nil {
+			return nil, err
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+	if cmd.WebK8sDeployment != "" {
+		workload, err := ParseK8sWebWorkload(cmd.WebK8sDeployment)
+		if err != nil {
+			return nil, err
+		}
+		return FindWebPods(client, &workload, "", cmd.WebContainer)
+	}
+	return FindWebPods(client, nil, cmd.HelmRelease, cmd.WebContainer)
 }
 
 type DBAccountant struct {
 	Opener PostgresOpener
+	Filter WorkloadFilter
+	// IncludeUnknown keeps the containers no workload is found for, as
+	// unaccounted samples. They belong to no team or pipeline, so they are
+	// left out whenever the Filter restricts either.
+	IncludeUnknown bool
 }
 
 func (da *DBAccountant) Account(containers []Container) ([]Sample, error) {
@@ -42,18 +175,45 @@ func (da *DBAccountant) Account(containers []Container) ([]Sample, error) {
 	}
 	defer conn.Close()
 
+	instanceVars, err := instanceVarsColumn(conn)
+	if err != nil {
+		return nil, err
+	}
 	samples := []Sample{}
-	resourceSamples, err := resourceSamples(conn, containers)
+	resourceSamples, err := resourceSamples(conn, containers, da.Filter, instanceVars)
 	if err != nil {
 		return nil, err
 	}
 	samples = append(samples, resourceSamples...)
-	buildSamples, err := buildSamples(conn, containers)
+	buildSamples, err := buildSamples(conn, containers, da.Filter, instanceVars)
 	if err != nil {
 		return nil, err
 	}
 	samples = append(samples, buildSamples...)
+	imageSamples, err := imageSamples(conn, containers, da.Filter, instanceVars)
+	if err != nil {
+		return nil, err
+	}
+	samples = append(samples, imageSamples...)
+
+	if da.IncludeUnknown && len(da.Filter.Teams) == 0 && len(da.Filter.Pipelines) == 0 {
+		labelled := map[string]bool{}
+		for _, sample := range samples {
+			labelled[sample.Container.Handle] = true
+		}
+		for _, container := range containers {
+			if !labelled[container.Handle] {
+				samples = append(samples, Sample{
+					Container: container,
+					Labels:    Labels{Type: ContainerTypeUnaccounted},
+				})
+			}
+		}
+	}
 
+	for i := range samples {
+		samples[i].Labels.Worker = samples[i].Container.Worker
+	}
 	return samples, nil
 }
 
@@ -64,3 +224,68 @@ func filterHandles(containers []Container) sq.Eq {
 	}
 	return sq.Eq{"c.handle": handles}
 }
+
+// instanceVarsColumn is what to select for the instance vars of the pipeline
+// aliased p. Pipelines only have instance vars from concourse 7 on, so
+// against older schemas it selects NULL.
+func instanceVarsColumn(conn *sql.DB) (string, error) {
+	var exists bool
+	err := conn.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'pipelines' AND column_name = 'instance_vars'
+		)`,
+	).Scan(&exists)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "NULL", nil
+	}
+	return "p.instance_vars", nil
+}
+
+// pipelineRef names an instance of a pipeline the way fly does, i.e.
+// pipeline/branch:main,version:1, so that instances of the same pipeline can
+// be told apart. Nested vars are flattened into dotted names.
+func pipelineRef(name string, instanceVars sql.NullString) (string, error) {
+	if !instanceVars.Valid {
+		return name, nil
+	}
+	var vars map[string]interface{}
+	err := json.Unmarshal([]byte(instanceVars.String), &vars)
+	if err != nil {
+		return "", err
+	}
+	if len(vars) == 0 {
+		return name, nil
+	}
+	pairs := []string{}
+	err = flattenInstanceVars("", vars, &pairs)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(pairs)
+	return name + "/" + strings.Join(pairs, ","), nil
+}
+
+func flattenInstanceVars(prefix string, vars map[string]interface{}, pairs *[]string) error {
+	for key, value := range vars {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			err := flattenInstanceVars(prefix+key+".", v, pairs)
+			if err != nil {
+				return err
+			}
+		case string:
+			*pairs = append(*pairs, prefix+key+":"+v)
+		default:
+			rendered, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			*pairs = append(*pairs, prefix+key+":"+string(rendered))
+		}
+	}
+	return nil
+}
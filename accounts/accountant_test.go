@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"time"
 
 	"code.cloudfoundry.org/garden"
 	"code.cloudfoundry.org/garden/gardenfakes"
+	"code.cloudfoundry.org/garden/server"
 	"code.cloudfoundry.org/lager/lagerctx"
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/concourse/baggageclaim"
@@ -317,6 +319,72 @@ func (s *AccountantSuite) TestAccountsForResourceCheckContainers() {
 	s.Equal(samples[0].Labels.Type, db.ContainerTypeCheck)
 }
 
+func (s *AccountantSuite) TestAccountsForResourceTypeCheckContainers() {
+	atc.EnableGlobalResources = true
+	s.registerWorker()
+	_, _, err := s.team.SavePipeline(
+		"p",
+		atc.Config{
+			ResourceTypes: atc.ResourceTypes{
+				{
+					Name:   "custom",
+					Type:   "git",
+					Source: atc.Source{"some": "repository"},
+				},
+			},
+			Resources: atc.ResourceConfigs{
+				{
+					Name:   "r",
+					Type:   "custom",
+					Source: atc.Source{"some": "source"},
+				},
+			},
+			Jobs: atc.JobConfigs{
+				{
+					Name:         "some-job",
+					PlanSequence: []atc.Step{{Config: &atc.GetStep{Name: "r"}}},
+				},
+			},
+		},
+		0,
+		false,
+	)
+	s.NoError(err)
+	s.checkResources()
+	accountant := &accounts.DBAccountant{
+		Opener: &accounts.StaticPostgresOpener{flag.PostgresConfig{
+			Host:     dbHost(),
+			Port:     5432,
+			User:     "postgres",
+			Password: "password",
+			Database: testDBName(),
+			SSLMode:  "disable",
+		}},
+	}
+	s.Eventually(
+		func() bool {
+			cs, _ := s.team.Containers()
+			return len(cs) > 0
+		},
+		time.Second,
+		100*time.Millisecond,
+	)
+	containers := []accounts.Container{}
+	dbContainers, _ := s.team.Containers()
+	for _, container := range dbContainers {
+		containers = append(containers, accounts.Container{Handle: container.Handle()})
+	}
+	samples, err := accountant.Account(containers)
+	s.NoError(err)
+	workloadStrings := []string{}
+	for _, sample := range samples {
+		for _, workload := range sample.Labels.Workloads {
+			workloadStrings = append(workloadStrings, workload.ToString())
+		}
+	}
+	s.Contains(workloadStrings, "main/p/type:custom")
+}
+
 func (s *AccountantSuite) TestAccountsForJobBuildContainers() {
 	// register a worker with "git" resource type
 	s.registerWorker()
@@ -438,3 +506,322 @@ func (s *AccountantSuite) TestAccountsForJobBuildContainers() {
 	}
 	s.Equal(workloadStrings, []string{"main/p/some-job/1/task"})
 }
+
+func (s *AccountantSuite) TestAccountsForOneOffBuildContainers() {
+	dbWorker, err := s.workerFactory.SaveWorker(atc.Worker{
+		Platform: "linux",
+		Version:  "0.0.0-dev",
+		Name:     "worker",
+	}, 10*time.Second)
+	s.NoError(err)
+	build, err := s.team.CreateOneOffBuild()
+	s.NoError(err)
+	container, err := dbWorker.CreateContainer(
+		db.NewBuildStepContainerOwner(build.ID(), "some-plan", s.team.ID()),
+		db.ContainerMetadata{
+			Type:      db.ContainerTypeTask,
+			StepName:  "one-off",
+			BuildID:   build.ID(),
+			BuildName: build.Name(),
+		},
+	)
+	s.NoError(err)
+	accountant := &accounts.DBAccountant{
+		Opener: &accounts.StaticPostgresOpener{flag.PostgresConfig{
+			Host:     dbHost(),
+			Port:     5432,
+			User:     "postgres",
+			Password: "password",
+			Database: testDBName(),
+			SSLMode:  "disable",
+		}},
+	}
+
+	samples, err := accountant.Account([]accounts.Container{{Handle: container.Handle()}})
+
+	s.NoError(err)
+	s.Len(samples, 1)
+	s.Equal(
+		fmt.Sprintf("main/one-off/%d/one-off", build.ID()),
+		samples[0].Labels.Workloads[0].ToString(),
+	)
+	s.Equal(db.ContainerTypeTask, samples[0].Labels.Type)
+}
+
+func (s *AccountantSuite) TestListsRunningWorkersAtTheirRegisteredAddresses() {
+	s.workerFactory.SaveWorker(atc.Worker{
+		Platform:        "linux",
+		Version:         "0.0.0-dev",
+		Name:            "worker",
+		GardenAddr:      "10.0.0.1:7777",
+		BaggageclaimURL: "http://10.0.0.1:7788",
+	}, 10*time.Second)
+	lister := &accounts.ATCWorkerLister{
+		Opener: &accounts.StaticPostgresOpener{flag.PostgresConfig{
+			Host:     dbHost(),
+			Port:     5432,
+			User:     "postgres",
+			Password: "password",
+			Database: testDBName(),
+			SSLMode:  "disable",
+		}},
+	}
+
+	workers, err := lister.Workers()
+
+	s.NoError(err)
+	s.Equal([]accounts.NamedWorker{{
+		Name: "worker",
+		Worker: &accounts.GardenWorker{
+			Dialer: &accounts.AddrDialer{GardenAddr: "10.0.0.1:7777"},
+		},
+	}}, workers)
+}
+
+type testWebDialer struct {
+	addrs []string
+}
+
+func (twd *testWebDialer) DialWeb(addr string) (net.Conn, error) {
+	twd.addrs = append(twd.addrs, addr)
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	return net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+}
+
+func (s *AccountantSuite) TestReachesWorkersAtTheirForwardedAddresses() {
+	backend := new(gardenfakes.FakeBackend)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	gardenServer := server.New(
+		"tcp",
+		listener.Addr().String(),
+		0,
+		backend,
+		lagertest.NewTestLogger("test"),
+	)
+	go gardenServer.Serve(listener)
+	defer gardenServer.Stop()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	s.NoError(err)
+	s.workerFactory.SaveWorker(atc.Worker{
+		Platform:        "linux",
+		Version:         "0.0.0-dev",
+		Name:            "tsa-worker",
+		GardenAddr:      "10.0.0.2:" + port,
+		BaggageclaimURL: "http://10.0.0.2:40000",
+	}, 10*time.Second)
+	web := &testWebDialer{}
+	worker := &accounts.GardenWorker{
+		Dialer: &accounts.ForwardedWorkerDialer{
+			Opener: &accounts.StaticPostgresOpener{flag.PostgresConfig{
+				Host:     dbHost(),
+				Port:     5432,
+				User:     "postgres",
+				Password: "password",
+				Database: testDBName(),
+				SSLMode:  "disable",
+			}},
+			WorkerName: "tsa-worker",
+			Web:        web,
+		},
+	}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, backend.ContainersCallCount())
+	s.Contains(web.addrs, "10.0.0.2:"+port)
+}
+
+func (s *AccountantSuite) TestFailsToReachUnregisteredWorkers() {
+	dialer := &accounts.ForwardedWorkerDialer{
+		Opener: &accounts.StaticPostgresOpener{flag.PostgresConfig{
+			Host:     dbHost(),
+			Port:     5432,
+			User:     "postgres",
+			Password: "password",
+			Database: testDBName(),
+			SSLMode:  "disable",
+		}},
+		WorkerName: "nobody",
+	}
+
+	_, err := dialer.Dial()
+
+	s.EqualError(err, "worker 'nobody' is not registered")
+}
+
+func (s *AccountantSuite) TestIncludesUnknownContainersAsUnaccounted() {
+	accountant := &accounts.DBAccountant{
+		Opener: &accounts.StaticPostgresOpener{flag.PostgresConfig{
+			Host:     dbHost(),
+			Port:     5432,
+			User:     "postgres",
+			Password: "password",
+			Database: testDBName(),
+			SSLMode:  "disable",
+		}},
+		IncludeUnknown: true,
+	}
+
+	samples, err := accountant.Account([]accounts.Container{{Handle: "stranger"}})
+
+	s.NoError(err)
+	s.Len(samples, 1)
+	s.Equal("stranger", samples[0].Container.Handle)
+	s.Equal(accounts.ContainerTypeUnaccounted, samples[0].Labels.Type)
+}
+
+func (s *AccountantSuite) TestReportsContainersMissingFromTheWorker() {
+	atc.EnableGlobalResources = true
+	s.registerWorker()
+	s.createResources(atc.ResourceConfigs{
+		{
+			Name:   "r",
+			Type:   "git",
+			Source: atc.Source{"some": "repository"},
+		},
+	})
+	s.checkResources()
+	s.Eventually(
+		func() bool {
+			cs, _ := s.team.Containers()
+			return len(cs) > 0
+		},
+		time.Second,
+		100*time.Millisecond,
+	)
+	opener := &accounts.StaticPostgresOpener{flag.PostgresConfig{
+		Host:     dbHost(),
+		Port:     5432,
+		User:     "postgres",
+		Password: "password",
+		Database: testDBName(),
+		SSLMode:  "disable",
+	}}
+	accountant := &accounts.MissingAccountant{
+		Accountant: &accounts.DBAccountant{Opener: opener, IncludeUnknown: true},
+		Opener:     opener,
+	}
+
+	samples, err := accountant.Account([]accounts.Container{
+		{Handle: "not-in-the-db", Worker: "worker"},
+	})
+
+	s.NoError(err)
+	dbContainers, _ := s.team.Containers()
+	s.Len(samples, len(dbContainers))
+	s.Equal("worker", samples[0].Labels.Worker)
+	s.Equal(db.ContainerTypeCheck, samples[0].Labels.Type)
+}
+
+func (s *AccountantSuite) TestMissingAccountantLooksOnTheNamedWorker() {
+	atc.EnableGlobalResources = true
+	s.registerWorker()
+	s.createResources(atc.ResourceConfigs{
+		{
+			Name:   "r",
+			Type:   "git",
+			Source: atc.Source{"some": "repository"},
+		},
+	})
+	s.checkResources()
+	s.Eventually(
+		func() bool {
+			cs, _ := s.team.Containers()
+			return len(cs) > 0
+		},
+		time.Second,
+		100*time.Millisecond,
+	)
+	opener := &accounts.StaticPostgresOpener{flag.PostgresConfig{
+		Host:     dbHost(),
+		Port:     5432,
+		User:     "postgres",
+		Password: "password",
+		Database: testDBName(),
+		SSLMode:  "disable",
+	}}
+	accountant := &accounts.MissingAccountant{
+		Accountant: &accounts.DBAccountant{Opener: opener, IncludeUnknown: true},
+		Opener:     opener,
+		Worker:     "worker",
+	}
+
+	// nothing in common with the database, i.e. a worker that was wiped
+	samples, err := accountant.Account([]accounts.Container{})
+
+	s.NoError(err)
+	dbContainers, _ := s.team.Containers()
+	s.Len(samples, len(dbContainers))
+	s.Equal("worker", samples[0].Labels.Worker)
+}
+
+func (s *AccountantSuite) TestMissingAccountantLooksOnWorkersWhichAnsweredWithNoContainers() {
+	atc.EnableGlobalResources = true
+	s.registerWorker()
+	s.createResources(atc.ResourceConfigs{
+		{
+			Name:   "r",
+			Type:   "git",
+			Source: atc.Source{"some": "repository"},
+		},
+	})
+	s.checkResources()
+	s.Eventually(
+		func() bool {
+			cs, _ := s.team.Containers()
+			return len(cs) > 0
+		},
+		time.Second,
+		100*time.Millisecond,
+	)
+	opener := &accounts.StaticPostgresOpener{flag.PostgresConfig{
+		Host:     dbHost(),
+		Port:     5432,
+		User:     "postgres",
+		Password: "password",
+		Database: testDBName(),
+		SSLMode:  "disable",
+	}}
+	accountant := &accounts.MissingAccountant{
+		Accountant: &accounts.DBAccountant{Opener: opener, IncludeUnknown: true},
+		Opener:     opener,
+		Workers:    answeredWorkers{"worker"},
+	}
+
+	samples, err := accountant.Account([]accounts.Container{})
+
+	s.NoError(err)
+	dbContainers, _ := s.team.Containers()
+	s.Len(samples, len(dbContainers))
+	s.Equal("worker", samples[0].Labels.Worker)
+}
+
+type answeredWorkers []string
+
+func (aw answeredWorkers) AnsweredWorkers() []string {
+	return aw
+}
+
+func (s *AccountantSuite) TestMissingAccountantNeedsToKnowTheWorker() {
+	opener := &accounts.StaticPostgresOpener{flag.PostgresConfig{
+		Host:     dbHost(),
+		Port:     5432,
+		User:     "postgres",
+		Password: "password",
+		Database: testDBName(),
+		SSLMode:  "disable",
+	}}
+	accountant := &accounts.MissingAccountant{
+		Accountant: &accounts.DBAccountant{Opener: opener},
+		Opener:     opener,
+	}
+
+	_, err := accountant.Account([]accounts.Container{{Handle: "some-handle"}})
+
+	s.EqualError(err, "cannot tell which worker container 'some-handle' is on")
+}
@@ -1,8 +1,10 @@
 package accounts
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,11 +18,59 @@ import (
 )
 
 type Command struct {
-	Postgres        flag.PostgresConfig
-	K8sNamespace    string
-	K8sPod          string
-	WebK8sNamespace string
-	WebK8sPod       string
+	Postgres           flag.PostgresConfig
+	K8sNamespace       string
+	K8sPod             string
+	K8sSelector        string
+	GardenAddr         string
+	WorkerName         string
+	MissingWorker      string
+	GardenPort         uint16
+	WebK8sNamespace    string
+	WebK8sPod          string
+	WebK8sDeployment   string
+	HelmRelease        string
+	WebContainer       string
+	WebDockerContainer string
+	DockerSocket       string
+	WebEnvFile         string
+	WebPID             int
+	BoshDeployment     string
+	BoshInstance       string
+	BoshWebInstance    string
+	BoshNetwork        string
+	BoshGatewayHost    string
+	BoshGatewayUser    string
+	BoshGatewayKey     string
+	BoshUser           string
+	BoshKey            string
+	SSHHost            string
+	SSHUser            string
+	SSHKey             string
+	KnownHosts         string
+	InsecureHostKeys   bool
+	GroupBy            string
+	SplitShared        bool
+	Output             string
+	SortBy             string
+	Reverse            bool
+	Teams              []string
+	Pipelines          []string
+	Types              []string
+	MinMemory          uint64
+	OlderThan          time.Duration
+	CPUInterval        time.Duration
+	Disk               bool
+	OpenFiles          bool
+	AllWorkers         bool
+	IncludeUnknown     bool
+	Subcommand         string
+	Listen             string
+	Interval           time.Duration
+	SnapshotPath       string
+	Since              time.Time
+	Until              time.Time
+	Builds             int
 }
 
 func Execute(
@@ -43,6 +93,13 @@ func Execute(
 		fmt.Fprintln(stdout, err.Error())
 		return 1
 	}
+	// these only need what was recorded, not a worker or database
+	switch cmd.Subcommand {
+	case "diff":
+		return diff(stdout, cmd)
+	case "jobs":
+		return jobs(stdout, cmd)
+	}
 	worker, err := workerFactory(cmd)
 	if err != nil {
 		fmt.Fprintf(stdout, "configuration error: %s\n", err.Error())
@@ -53,8 +110,43 @@ func Execute(
 		fmt.Fprintf(stdout, "configuration error: %s\n", err.Error())
 		return 1
 	}
-	containers, err := worker.Containers()
-	if err != nil {
+	// a pool knows which of its workers answered, even those with no
+	// containers left to find missing ones among
+	if missing, ok := accountant.(*MissingAccountant); ok {
+		if workers, ok := worker.(WorkerSet); ok {
+			missing.Workers = workers
+		}
+	}
+	if cmd.MinMemory > 0 || cmd.OlderThan > 0 {
+		worker = &FilteredWorker{
+			Worker:    worker,
+			MinMemory: cmd.MinMemory,
+			OlderThan: cmd.OlderThan,
+		}
+	}
+	if len(cmd.Types) > 0 {
+		accountant = &FilteredAccountant{
+			Accountant: accountant,
+			Types:      cmd.Types,
+		}
+	}
+	switch cmd.Subcommand {
+	case "serve":
+		return serve(stdout, cmd, worker, accountant)
+	case "top":
+		return top(stdout, cmd, worker, accountant)
+	case "record":
+		return record(stdout, cmd, worker, accountant)
+	}
+	exitCode := 0
+	containers, err := worker.Containers(statsOptions(cmd)...)
+	if workerErrors, ok := err.(WorkerErrors); ok {
+		// the workers which did answer are still worth accounting for
+		for _, name := range workerErrors.Names() {
+			fmt.Fprintf(stdout, "worker error: %s: %s\n", name, workerErrors[name].Error())
+		}
+		exitCode = 1
+	} else if err != nil {
 		fmt.Fprintf(stdout, "worker error: %s\n", err.Error())
 		return 1
 	}
@@ -63,11 +155,19 @@ func Execute(
 		fmt.Fprintf(stdout, "accountant error: %s\n", err.Error())
 		return 1
 	}
-	err = printSamples(stdout, samples)
+	if cmd.Subcommand == "shared" {
+		err = printSharedTable(stdout, SharedContainers(samples))
+		if err != nil {
+			return 1
+		}
+		return exitCode
+	}
+	SortSamples(samples, cmd.SortBy, cmd.Reverse)
+	err = printOutput(stdout, cmd, samples)
 	if err != nil {
 		return 1
 	}
-	return 0
+	return exitCode
 }
 
 func parseArgs(args []string, out io.Writer) (Command, error) {
@@ -76,11 +176,98 @@ func parseArgs(args []string, out io.Writer) (Command, error) {
 		Use:   "ft",
 		Short: "ft is an operator observability tool for concourse",
 	}
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve container accounts as prometheus metrics",
+	}
+	serveCmd.Flags().StringVar(&ftCmd.Listen, "listen", ":9391", "Address to serve prometheus metrics on")
+	serveCmd.Flags().DurationVar(&ftCmd.Interval, "interval", 30*time.Second, "How often to re-account the worker's containers")
+	topCmd := &cobra.Command{
+		Use:   "top",
+		Short: "Continuously redraw container accounts, marking what changed",
+	}
+	// flags bound to the same field share a default, so top's are copied
+	// over once it's known to be the subcommand being run
+	var topCmdFlags Command
+	topCmd.Flags().DurationVar(&topCmdFlags.Interval, "interval", 2*time.Second, "How often to re-account the worker's containers")
+	topCmd.Flags().StringVar(&topCmdFlags.SortBy, "sort", "memory", "Sort containers by one of: "+strings.Join(SortChoices, ", "))
+	topCmd.Flags().BoolVar(&topCmdFlags.Reverse, "reverse", false, "Reverse the sort order")
+	missingCmd := &cobra.Command{
+		Use:   "missing",
+		Short: "List containers the database has for a worker, but the worker doesn't",
+	}
+	missingCmd.Flags().StringVar(&ftCmd.Output, "output", "table", "Output format, one of: "+strings.Join(OutputChoices, ", "))
+	missingCmd.Flags().StringVar(&ftCmd.MissingWorker, "worker", "", "Name the worker is registered with, to look for its missing containers by (defaults to --worker-name, not needed with --all-workers or --k8s-selector)")
+	sharedCmd := &cobra.Command{
+		Use:   "shared",
+		Short: "List check containers shared by several resources, and each one's share of their memory",
+	}
+	recordCmd := &cobra.Command{
+		Use:   "record",
+		Short: "Append a snapshot of container accounts to a local file, to diff later",
+	}
+	var recordCmdFlags Command
+	recordCmd.Flags().StringVar(&ftCmd.SnapshotPath, "out", "snapshots.db", "File to append snapshots to")
+	recordCmd.Flags().DurationVar(&recordCmdFlags.Interval, "interval", 0, "How often to record a snapshot, 0 to record one and exit")
+	diffCmd := &cobra.Command{
+		Use:   "diff <from> <to>",
+		Short: "Show the containers created and destroyed, and memory change per workload, between two recorded snapshots",
+		Long: "Show the containers created and destroyed, and memory change per workload, between two recorded snapshots. " +
+			"Times are RFC3339, 'YYYY-MM-DD HH:MM' or 'HH:MM' today, and each picks the last snapshot at or before it.",
+	}
+	diffCmd.Flags().StringVar(&ftCmd.SnapshotPath, "in", "snapshots.db", "File to read snapshots from")
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Show the peak memory of each job's recent builds' task containers, from recorded snapshots",
+	}
+	jobsCmd.Flags().StringVar(&ftCmd.SnapshotPath, "in", "snapshots.db", "File to read snapshots from")
+	jobsCmd.Flags().IntVar(&ftCmd.Builds, "builds", 10, "How many of each job's latest builds to look at")
+	cobraCmd.AddCommand(serveCmd, topCmd, missingCmd, sharedCmd, recordCmd, diffCmd, jobsCmd)
 	var postgresCaCert, postgresClientCert, postgresClientKey string
 	cobraCmd.PersistentFlags().StringVar(&ftCmd.K8sNamespace, "k8s-namespace", "", "Kubernetes namespace containing the worker pod to query")
 	cobraCmd.PersistentFlags().StringVar(&ftCmd.K8sPod, "k8s-pod", "", "Name of the worker pod to query")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.K8sSelector, "k8s-selector", "", "Label selector for the worker pods to query, i.e. app=concourse-worker")
+	cobraCmd.PersistentFlags().BoolVar(&ftCmd.AllWorkers, "all-workers", false, "Query every running worker registered in the database instead of a single one")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.GardenAddr, "garden-addr", "127.0.0.1:7777", "Address of the worker's Garden, as host:port or the path of a unix socket (as seen from the host when signing in over SSH)")
+	cobraCmd.PersistentFlags().Uint16Var(&ftCmd.GardenPort, "garden-port", 7777, "Port Garden listens on inside worker pods, for port-forwarding")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.WorkerName, "worker-name", "", "Name of a worker registered through TSA, to query at the addresses forwarded to it on the web node (through the web pod, if given)")
 	cobraCmd.PersistentFlags().StringVar(&ftCmd.WebK8sNamespace, "web-k8s-namespace", "", "Kubernetes namespace containing the web pod to inpect for connection information")
 	cobraCmd.PersistentFlags().StringVar(&ftCmd.WebK8sPod, "web-k8s-pod", "", "Name of the web pod to inspect for connection information")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.WebK8sDeployment, "web-k8s-deployment", "", "Deployment running the web pods, or statefulset/<name>, to inspect a ready web pod of (or its pod template) for connection information")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.HelmRelease, "helm-release", "", "Helm release whose web pods to inspect for connection information, found like --web-k8s-deployment")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.WebContainer, "web-container", "", "Name of the container in web pods running concourse web (defaults to the one with 'web' in its name)")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.WebDockerContainer, "web-docker-container", "", "Name or ID of a web container run by Docker on this host, i.e. from docker-compose, to inspect for connection information")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.DockerSocket, "docker-socket", DefaultDockerSocket, "Path of the Docker Engine API's unix socket")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.WebEnvFile, "web-env-file", "", "Environment file or systemd unit a web node on this host is started with, to inspect for connection information")
+	cobraCmd.PersistentFlags().IntVar(&ftCmd.WebPID, "web-pid", 0, "Process ID of a concourse web running on this host, to inspect for connection information")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshDeployment, "bosh-deployment", "", "BOSH deployment containing the worker and web instances to inspect")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshInstance, "bosh-instance", "", "BOSH worker instance to query, i.e. worker/0")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshWebInstance, "bosh-web-instance", "", "BOSH web instance to inspect for connection information, i.e. web/0")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshNetwork, "bosh-network", "default", "BOSH network the instances are reachable on")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshGatewayHost, "bosh-gateway-host", "", "SSH gateway in front of the BOSH deployment's network, resolving BOSH DNS names")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshGatewayUser, "bosh-gateway-user", "jumpbox", "User to sign in to the SSH gateway as")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshGatewayKey, "bosh-gateway-key", "", "Private key file location, to sign in to the SSH gateway with")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshUser, "bosh-user", "vcap", "User to sign in to BOSH instances as")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.BoshKey, "bosh-key", "", "Private key file location, to sign in to BOSH instances with (defaults to --bosh-gateway-key)")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.SSHHost, "ssh-host", "", "Remote worker host to query over SSH, i.e. worker.example.com:22")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.SSHUser, "ssh-user", "root", "User to sign in to the remote worker host as")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.SSHKey, "ssh-key", "", "Private key file location, to sign in to the remote worker host with (defaults to the keys in the ssh-agent at $SSH_AUTH_SOCK)")
+	cobraCmd.PersistentFlags().StringVar(&ftCmd.KnownHosts, "known-hosts", "", "known_hosts file to check the host keys of SSH gateways, instances and hosts against (defaults to ~/.ssh/known_hosts)")
+	cobraCmd.PersistentFlags().BoolVar(&ftCmd.InsecureHostKeys, "insecure-skip-host-key-check", false, "Sign in over SSH without checking host keys, for hosts too short-lived to be in known_hosts")
+	cobraCmd.Flags().StringVar(&ftCmd.GroupBy, "group-by", "", "Aggregate containers by one of: "+strings.Join(GroupByChoices, ", "))
+	cobraCmd.Flags().BoolVar(&ftCmd.SplitShared, "split-shared", false, "Divide shared containers' memory between the groups sharing them, instead of counting it towards each")
+	cobraCmd.Flags().StringVar(&ftCmd.Output, "output", "table", "Output format, one of: "+strings.Join(OutputChoices, ", "))
+	cobraCmd.Flags().StringVar(&ftCmd.SortBy, "sort", "", "Sort containers by one of: "+strings.Join(SortChoices, ", "))
+	cobraCmd.Flags().BoolVar(&ftCmd.Reverse, "reverse", false, "Reverse the sort order")
+	cobraCmd.PersistentFlags().StringSliceVar(&ftCmd.Teams, "team", nil, "Only account for containers belonging to these teams")
+	cobraCmd.PersistentFlags().StringSliceVar(&ftCmd.Pipelines, "pipeline", nil, "Only account for containers belonging to these pipelines")
+	cobraCmd.PersistentFlags().BoolVar(&ftCmd.IncludeUnknown, "include-unknown", false, "Account for containers the database has no workload for, as type unaccounted")
+	cobraCmd.PersistentFlags().StringSliceVar(&ftCmd.Types, "type", nil, "Only account for containers of these types: "+strings.Join(TypeChoices, ", "))
+	cobraCmd.PersistentFlags().Var(byteSizeValue{&ftCmd.MinMemory}, "min-memory", "Only account for containers using at least this much memory, i.e. 500MB")
+	cobraCmd.PersistentFlags().DurationVar(&ftCmd.OlderThan, "older-than", 0, "Only account for containers older than this, i.e. 2h")
+	cobraCmd.PersistentFlags().DurationVar(&ftCmd.CPUInterval, "cpu-interval", 0, "How long to watch containers for to measure CPU utilisation (defaults to 1s when sorting by cpu or running top, otherwise CPU is not measured)")
+	cobraCmd.PersistentFlags().BoolVar(&ftCmd.Disk, "disk", false, "Measure the disk used by each container's volumes by running du in it")
+	cobraCmd.PersistentFlags().BoolVar(&ftCmd.OpenFiles, "open-files", false, "Count each container's open files by running a shell in it")
 	cobraCmd.PersistentFlags().StringVar(&ftCmd.Postgres.Host, "postgres-host", "127.0.0.1", "The postgres host to connect to")
 	cobraCmd.PersistentFlags().Uint16Var(&ftCmd.Postgres.Port, "postgres-port", 5432, "The postgres port to connect to")
 	cobraCmd.PersistentFlags().StringVar(&ftCmd.Postgres.User, "postgres-user", "", "The postgres user to sign in as")
@@ -92,33 +279,94 @@ func parseArgs(args []string, out io.Writer) (Command, error) {
 	cobraCmd.PersistentFlags().StringVar(&postgresClientKey, "postgres-client-key", "", "Client key file location, to use when connecting to postgres with SSL")
 
 	cobraCmd.SetOut(out)
-	cobraCmd.InitDefaultHelpFlag()
-	err := cobraCmd.ParseFlags(args)
-	if helpVal, _ := cobraCmd.Flags().GetBool("help"); helpVal {
-		cobraCmd.HelpFunc()(cobraCmd, args)
-		cobraCmd.Println(cobraCmd.UsageString())
+	subCmd, subArgs, err := cobraCmd.Find(args)
+	if err != nil {
+		return ftCmd, err
+	}
+	if subCmd != cobraCmd {
+		ftCmd.Subcommand = subCmd.Name()
+	}
+	subCmd.InitDefaultHelpFlag()
+	err = subCmd.ParseFlags(subArgs)
+	if helpVal, _ := subCmd.Flags().GetBool("help"); helpVal {
+		subCmd.HelpFunc()(subCmd, args)
+		subCmd.Println(subCmd.UsageString())
 		return ftCmd, pflag.ErrHelp
 	}
+	if subCmd == topCmd {
+		ftCmd.Interval = topCmdFlags.Interval
+		ftCmd.SortBy = topCmdFlags.SortBy
+		ftCmd.Reverse = topCmdFlags.Reverse
+	}
+	if subCmd == recordCmd {
+		ftCmd.Interval = recordCmdFlags.Interval
+	}
+	if subCmd == diffCmd && err == nil {
+		times := subCmd.Flags().Args()
+		if len(times) != 2 {
+			return ftCmd, errors.New("diff needs the times to compare, i.e. ft diff 02:00 03:00")
+		}
+		now := time.Now()
+		ftCmd.Since, err = ParseSnapshotTime(times[0], now)
+		if err != nil {
+			return ftCmd, err
+		}
+		ftCmd.Until, err = ParseSnapshotTime(times[1], now)
+		if err != nil {
+			return ftCmd, err
+		}
+	}
 	ftCmd.Postgres.CACert = flag.File(postgresCaCert)
 	ftCmd.Postgres.ClientCert = flag.File(postgresClientCert)
 	ftCmd.Postgres.ClientKey = flag.File(postgresClientKey)
 	return ftCmd, err
 }
 
-func printSamples(writer io.Writer, samples []Sample) error {
-	data := []ui.TableRow{}
+// DefaultCPUInterval is how long containers are watched for to measure CPU
+// utilisation when it is needed and --cpu-interval isn't given.
+const DefaultCPUInterval = time.Second
+
+func statsOptions(cmd Command) []StatsOption {
+	// measuring CPU takes a second sample an interval later, so it is only
+	// done when asked for or when CPU is sorted by or watched
+	interval := cmd.CPUInterval
+	if interval == 0 && (cmd.SortBy == "cpu" || cmd.Subcommand == "top") {
+		interval = DefaultCPUInterval
+	}
+	opts := []StatsOption{WithCPUInterval(interval)}
+	if cmd.OpenFiles {
+		opts = append(opts, WithOpenFiles())
+	}
+	return opts
+}
+
+func printSampleTable(writer io.Writer, samples []Sample) error {
+	// the worker column is only worth its width when there is more than one
+	// worker's containers in the table
+	showWorker := false
 	for _, sample := range samples {
-		workloads := []string{}
-		for _, w := range sample.Labels.Workloads {
-			workloads = append(workloads, w.ToString())
+		if sample.Labels.Worker != "" {
+			showWorker = true
+			break
 		}
-		data = append(data, ui.TableRow{
-			ui.TableCell{Contents: strings.Join(workloads, ",")},
+	}
+	data := []ui.TableRow{}
+	for _, sample := range samples {
+		row := ui.TableRow{
+			ui.TableCell{Contents: workloadString(sample)},
 			ui.TableCell{Contents: string(sample.Labels.Type)},
 			ui.TableCell{Contents: humanReadable(sample.Container.Stats.Memory)},
+			ui.TableCell{Contents: cpuPercent(sample.Container.Stats)},
+			ui.TableCell{Contents: diskSize(sample.Container.Stats)},
+			ui.TableCell{Contents: strconv.FormatUint(sample.Container.Stats.Processes, 10)},
+			ui.TableCell{Contents: openFiles(sample.Container.Stats)},
 			ui.TableCell{Contents: sample.Container.Stats.Age.String()},
 			ui.TableCell{Contents: sample.Container.Handle},
-		})
+		}
+		if showWorker {
+			row = append(row, ui.TableCell{Contents: sample.Labels.Worker})
+		}
+		data = append(data, row)
 	}
 	table := ui.Table{
 		Headers: ui.TableRow{
@@ -134,6 +382,22 @@ func printSamples(writer io.Writer, samples []Sample) error {
 				Contents: "memory",
 				Color:    color.New(color.Bold),
 			},
+			ui.TableCell{
+				Contents: "cpu",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "disk",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "processes",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "files",
+				Color:    color.New(color.Bold),
+			},
 			ui.TableCell{
 				Contents: "age",
 				Color:    color.New(color.Bold),
@@ -145,6 +409,12 @@ func printSamples(writer io.Writer, samples []Sample) error {
 		},
 		Data: data,
 	}
+	if showWorker {
+		table.Headers = append(table.Headers, ui.TableCell{
+			Contents: "worker",
+			Color:    color.New(color.Bold),
+		})
+	}
 	return table.Render(writer, true)
 }
 
@@ -152,6 +422,33 @@ func humanReadable(bytes uint64) string {
 	return datasize.ByteSize(bytes).HumanReadable()
 }
 
+// openFiles shows a count of open files, or - when it wasn't or couldn't be
+// counted.
+func openFiles(stats Stats) string {
+	if !stats.OpenFilesMeasured {
+		return "-"
+	}
+	return strconv.FormatUint(stats.OpenFiles, 10)
+}
+
+// diskSize shows the disk a container's volumes use, or - when it wasn't
+// measured.
+func diskSize(stats Stats) string {
+	if !stats.DiskMeasured {
+		return "-"
+	}
+	return humanReadable(stats.Disk)
+}
+
+// cpuPercent shows how busy a container kept the CPU, or - when it wasn't
+// measured.
+func cpuPercent(stats Stats) string {
+	if !stats.CPUMeasured {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", stats.CPUPercent)
+}
+
 type Sample struct {
 	Container Container
 	Labels    Labels
@@ -160,6 +457,10 @@ type Sample struct {
 type Labels struct {
 	Type      db.ContainerType
 	Workloads []Workload
+	// Worker is the name of the worker the container runs on, or of its pod
+	// when workers are found with --k8s-selector. It is only known when ft
+	// queries more than one worker.
+	Worker string
 }
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Accountant
@@ -171,11 +472,37 @@ type Accountant interface {
 type Container struct {
 	Handle string
 	Stats  Stats
+	// Worker is the name of the worker the container was found on, if the
+	// Worker it came from knows it.
+	Worker string
 }
 
 type Stats struct {
 	Memory uint64
 	Age    time.Duration
+	// CPUTime is the total CPU time the container has used since it was
+	// created.
+	CPUTime time.Duration
+	// CPUPercent is how busy the container kept the CPU between two samples,
+	// where 100 means one whole core. It is only measured when Containers is
+	// given a CPU sampling interval, in which case CPUMeasured is set.
+	CPUPercent  float64
+	CPUMeasured bool
+	// Disk is the size of the files in the container's volumes. It is only
+	// measured when ft is run with --disk, and only set when every volume
+	// could be sized, in which case DiskMeasured is set.
+	Disk         uint64
+	DiskMeasured bool
+	// Processes is the number of processes running in the container.
+	Processes uint64
+	// OpenFiles is the number of file descriptors held by the container's
+	// processes. It is only measured when Containers is asked to count them,
+	// in which case OpenFilesMeasured is set unless counting failed.
+	OpenFiles         uint64
+	OpenFilesMeasured bool
+	// OpenFilesError is why OpenFiles couldn't be counted, i.e. because the
+	// container has no shell.
+	OpenFilesError error
 }
 
 // a Workload is a description of a concourse core concept that corresponds to
@@ -186,6 +513,19 @@ type Stats struct {
 
 type Workload interface {
 	ToString() string
+	Fields() WorkloadFields
+}
+
+// WorkloadFields are the parts a Workload is made of. Fields which make no
+// sense for a given kind of Workload (i.e. the job of a resource check) are
+// left empty.
+type WorkloadFields struct {
+	Team     string `json:"team"`
+	Pipeline string `json:"pipeline"`
+	Job      string `json:"job"`
+	Build    string `json:"build"`
+	Step     string `json:"step"`
+	Resource string `json:"resource"`
 }
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Worker
@@ -194,4 +534,33 @@ type Worker interface {
 	Containers(...StatsOption) ([]Container, error)
 }
 
-type StatsOption func()
+type StatsOption func(*StatsOptions)
+
+type StatsOptions struct {
+	CPUInterval time.Duration
+	OpenFiles   bool
+}
+
+// WithCPUInterval makes a Worker sample its containers' CPU usage twice,
+// interval apart, to work out their CPU utilisation.
+func WithCPUInterval(interval time.Duration) StatsOption {
+	return func(options *StatsOptions) {
+		options.CPUInterval = interval
+	}
+}
+
+// WithOpenFiles makes a Worker count the files its containers have open,
+// which means running a process in every container.
+func WithOpenFiles() StatsOption {
+	return func(options *StatsOptions) {
+		options.OpenFiles = true
+	}
+}
+
+func NewStatsOptions(opts ...StatsOption) StatsOptions {
+	options := StatsOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
@@ -32,4 +32,49 @@ func TestAccounts(t *testing.T) {
 	suite.Run(t, &GardenConnectionSuite{
 		Assertions: require.New(t),
 	})
+	suite.Run(t, &ExporterSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &OutputSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &FiltersSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &VolumeAccountantSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &WorkerPoolSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &BoshSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &SSHGardenDialerSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &TopSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &SharedSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &SnapshotSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &JobsSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &DockerSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &LocalWebNodeSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &K8sWebWorkloadSuite{
+		Assertions: require.New(t),
+	})
+	suite.Run(t, &K8sPostgresDialerSuite{
+		Assertions: require.New(t),
+	})
 }
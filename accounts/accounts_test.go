@@ -3,6 +3,10 @@ package accounts_test
 import (
 	"bytes"
 	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/concourse/ft/accounts"
 	"github.com/concourse/ft/accounts/accountsfakes"
@@ -46,6 +50,31 @@ func (s *AccountsSuite) TestHandlesWorkerErrors() {
 	s.Contains(buf.String(), "worker error: pod not found\n")
 }
 
+func (s *AccountsSuite) TestOnlyMeasuresCPUWhenAskedFor() {
+	for args, interval := range map[string]time.Duration{
+		"":                     0,
+		"--sort cpu":           accounts.DefaultCPUInterval,
+		"--cpu-interval 250ms": 250 * time.Millisecond,
+	} {
+		fakeWorker := new(accountsfakes.FakeWorker)
+		fakeWorker.ContainersReturns(nil, errors.New("stop here"))
+
+		accounts.Execute(
+			func(accounts.Command) (accounts.Worker, error) {
+				return fakeWorker, nil
+			},
+			noopAccountantFactory,
+			noopValidator,
+			strings.Fields(args),
+			bytes.NewBuffer([]byte{}),
+		)
+
+		s.Equal(1, fakeWorker.ContainersCallCount(), args)
+		options := accounts.NewStatsOptions(fakeWorker.ContainersArgsForCall(0)...)
+		s.Equal(interval, options.CPUInterval, args)
+	}
+}
+
 func (s *AccountsSuite) TestPrintsUsageWhenHelpFlagIsPassed() {
 	buf := bytes.NewBuffer([]byte{})
 	returnCode := accounts.Execute(
@@ -201,3 +230,359 @@ func (s *AccountsSuite) TestFailsOnTerminalIOErrors() {
 
 	s.Equal(returnCode, 1)
 }
+
+type testWorkload struct {
+	fields accounts.WorkloadFields
+}
+
+func (tw testWorkload) ToString() string {
+	return tw.fields.Team + "/" + tw.fields.Pipeline
+}
+
+func (tw testWorkload) Fields() accounts.WorkloadFields {
+	return tw.fields
+}
+
+func (s *AccountsSuite) TestGroupsSamplesByPipeline() {
+	buf := bytes.NewBuffer([]byte{})
+	fakeWorker := new(accountsfakes.FakeWorker)
+	fakeAccountant := new(accountsfakes.FakeAccountant)
+	sample := func(handle, pipeline string, memory uint64) accounts.Sample {
+		return accounts.Sample{
+			Container: accounts.Container{
+				Handle: handle,
+				Stats:  accounts.Stats{Memory: memory},
+			},
+			Labels: accounts.Labels{
+				Workloads: []accounts.Workload{
+					testWorkload{accounts.WorkloadFields{
+						Team:     "main",
+						Pipeline: pipeline,
+					}},
+				},
+			},
+		}
+	}
+	fakeAccountant.AccountReturns(
+		[]accounts.Sample{
+			sample("a", "small", 1024),
+			sample("b", "big", 3*1024*1024),
+			sample("c", "big", 1024*1024),
+		},
+		nil,
+	)
+
+	returnCode := accounts.Execute(
+		func(accounts.Command) (accounts.Worker, error) {
+			return fakeWorker, nil
+		}, func(accounts.Command) (accounts.Accountant, error) {
+			return fakeAccountant, nil
+		},
+		noopValidator,
+		[]string{"--group-by", "pipeline"},
+		buf,
+	)
+
+	s.Equal(0, returnCode)
+	s.Regexp(`main/big\s+2\s+4.0 MB\s+3.0 MB`, buf.String())
+	s.Regexp(`main/small\s+1\s+1024 B\s+1024 B`, buf.String())
+	s.Less(
+		bytes.Index(buf.Bytes(), []byte("main/big")),
+		bytes.Index(buf.Bytes(), []byte("main/small")),
+	)
+}
+
+func (s *AccountsSuite) TestGroupingCountsSharedContainersOncePerGroup() {
+	groups, err := accounts.GroupSamples("team", []accounts.Sample{
+		{
+			Container: accounts.Container{
+				Stats: accounts.Stats{Memory: 100, Age: time.Hour},
+			},
+			Labels: accounts.Labels{
+				Workloads: []accounts.Workload{
+					testWorkload{accounts.WorkloadFields{Team: "main", Pipeline: "p"}},
+					testWorkload{accounts.WorkloadFields{Team: "main", Pipeline: "q"}},
+					testWorkload{accounts.WorkloadFields{Team: "other", Pipeline: "p"}},
+				},
+			},
+		},
+	})
+
+	s.NoError(err)
+	s.Equal([]accounts.Group{
+		{Key: "main", Containers: 1, TotalMemory: 100, MaxMemory: 100, OldestAge: time.Hour},
+		{Key: "other", Containers: 1, TotalMemory: 100, MaxMemory: 100, OldestAge: time.Hour},
+	}, groups)
+}
+
+func (s *AccountsSuite) TestGroupingByJobCollectsNonJobWorkloads() {
+	groups, err := accounts.GroupSamples("job", []accounts.Sample{
+		{
+			Labels: accounts.Labels{
+				Workloads: []accounts.Workload{
+					testWorkload{accounts.WorkloadFields{Team: "main", Pipeline: "p", Resource: "r"}},
+				},
+			},
+		},
+	})
+
+	s.NoError(err)
+	s.Len(groups, 1)
+	s.Equal("none", groups[0].Key)
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsUnknownGroupBy() {
+	err := accounts.DefaultValidator(accounts.Command{GroupBy: "colour"})
+
+	s.EqualError(
+		err,
+		"invalid value 'colour' for --group-by, must be one of: team, pipeline, job, resource, type, worker",
+	)
+}
+
+func (s *AccountsSuite) TestParsesServeSubcommand() {
+	var cmd accounts.Command
+
+	returnCode := accounts.Execute(
+		func(c accounts.Command) (accounts.Worker, error) {
+			cmd = c
+			return nil, errors.New("no worker")
+		},
+		noopAccountantFactory,
+		noopValidator,
+		[]string{"serve", "--listen", ":1234", "--k8s-pod", "worker-0"},
+		bytes.NewBuffer([]byte{}),
+	)
+
+	s.Equal(1, returnCode)
+	s.Equal("serve", cmd.Subcommand)
+	s.Equal(":1234", cmd.Listen)
+	s.Equal(30*time.Second, cmd.Interval)
+	s.Equal("worker-0", cmd.K8sPod)
+}
+
+func (s *AccountsSuite) TestFailsOnUnknownSubcommands() {
+	buf := bytes.NewBuffer([]byte{})
+
+	returnCode := accounts.Execute(
+		noopWorkerFactory,
+		noopAccountantFactory,
+		noopValidator,
+		[]string{"frobnicate"},
+		buf,
+	)
+
+	s.Equal(1, returnCode)
+	s.Contains(buf.String(), `unknown command "frobnicate"`)
+}
+
+func (s *AccountsSuite) TestReportsEachFailedWorkerAndPrintsTheRest() {
+	buf := bytes.NewBuffer([]byte{})
+	fakeWorker := new(accountsfakes.FakeWorker)
+	container := accounts.Container{Handle: "abc123", Worker: "worker-1"}
+	fakeWorker.ContainersReturns(
+		[]accounts.Container{container},
+		accounts.WorkerErrors{
+			"worker-2": errors.New("connection refused"),
+			"worker-3": errors.New("i/o timeout"),
+		},
+	)
+	fakeAccountant := new(accountsfakes.FakeAccountant)
+	fakeAccountant.AccountReturns(
+		[]accounts.Sample{{
+			Container: container,
+			Labels:    accounts.Labels{Worker: "worker-1"},
+		}},
+		nil,
+	)
+
+	returnCode := accounts.Execute(
+		func(accounts.Command) (accounts.Worker, error) {
+			return fakeWorker, nil
+		}, func(accounts.Command) (accounts.Accountant, error) {
+			return fakeAccountant, nil
+		},
+		noopValidator,
+		[]string{},
+		buf,
+	)
+
+	s.Equal(1, returnCode)
+	s.Contains(buf.String(), "worker error: worker-2: connection refused\n")
+	s.Contains(buf.String(), "worker error: worker-3: i/o timeout\n")
+	s.Equal([]accounts.Container{container}, fakeAccountant.AccountArgsForCall(0))
+	s.Regexp(`abc123\s+worker-1`, buf.String())
+}
+
+func (s *AccountsSuite) TestGroupsSamplesByWorker() {
+	groups, err := accounts.GroupSamples("worker", []accounts.Sample{
+		{Labels: accounts.Labels{Worker: "worker-1"}},
+		{Labels: accounts.Labels{Worker: "worker-1"}},
+		{Labels: accounts.Labels{}},
+	})
+
+	s.NoError(err)
+	s.Equal([]accounts.Group{
+		{Key: "none", Containers: 1},
+		{Key: "worker-1", Containers: 2},
+	}, groups)
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsDiskAcrossAllWorkers() {
+	err := accounts.DefaultValidator(accounts.Command{AllWorkers: true, Disk: true})
+
+	s.EqualError(err, "--disk is not supported with --all-workers")
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsSelectorWithPod() {
+	err := accounts.DefaultValidator(accounts.Command{
+		K8sNamespace: "ci",
+		K8sPod:       "worker-0",
+		K8sSelector:  "app=concourse-worker",
+	})
+
+	s.EqualError(err, "--k8s-selector cannot be combined with --k8s-pod or --all-workers")
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsBoshInstanceWithPod() {
+	key, err := ioutil.TempFile("", "ft-key")
+	s.NoError(err)
+	key.Close()
+	defer os.Remove(key.Name())
+
+	err = accounts.DefaultValidator(accounts.Command{
+		BoshDeployment:  "concourse",
+		BoshInstance:    "worker/0",
+		BoshGatewayHost: "jumpbox.example.com",
+		BoshGatewayKey:  key.Name(),
+		K8sNamespace:    "ci",
+		K8sPod:          "worker-0",
+	})
+
+	s.EqualError(err, "--bosh-instance cannot be combined with --k8s-pod, --k8s-selector or --all-workers")
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsSSHHostWithOtherWorkers() {
+	key, err := ioutil.TempFile("", "ft-key")
+	s.NoError(err)
+	key.Close()
+	defer os.Remove(key.Name())
+
+	for _, cmd := range []accounts.Command{
+		{
+			BoshDeployment:  "concourse",
+			BoshInstance:    "worker/0",
+			BoshGatewayHost: "jumpbox.example.com",
+			BoshGatewayKey:  key.Name(),
+		},
+		{K8sNamespace: "ci", K8sPod: "worker-0"},
+		{AllWorkers: true},
+	} {
+		cmd.SSHHost = "worker.example.com"
+		cmd.SSHKey = key.Name()
+
+		err := accounts.DefaultValidator(cmd)
+
+		s.EqualError(err, "--ssh-host cannot be combined with --bosh-instance, --k8s-pod, --k8s-selector or --all-workers")
+	}
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsWorkerNameWithOtherWorkers() {
+	err := accounts.DefaultValidator(accounts.Command{
+		WorkerName: "tsa-worker",
+		AllWorkers: true,
+	})
+
+	s.EqualError(err, "--worker-name cannot be combined with other ways of choosing a worker")
+}
+
+func (s *AccountsSuite) TestParsesTopSubcommand() {
+	var cmd accounts.Command
+
+	returnCode := accounts.Execute(
+		func(c accounts.Command) (accounts.Worker, error) {
+			cmd = c
+			return nil, errors.New("no worker")
+		},
+		noopAccountantFactory,
+		noopValidator,
+		[]string{"top", "--interval", "5s"},
+		bytes.NewBuffer([]byte{}),
+	)
+
+	s.Equal(1, returnCode)
+	s.Equal("top", cmd.Subcommand)
+	s.Equal(5*time.Second, cmd.Interval)
+	s.Equal("memory", cmd.SortBy)
+}
+
+func (s *AccountsSuite) TestParsesMissingSubcommand() {
+	var cmd accounts.Command
+
+	returnCode := accounts.Execute(
+		func(c accounts.Command) (accounts.Worker, error) {
+			cmd = c
+			return nil, errors.New("no worker")
+		},
+		noopAccountantFactory,
+		noopValidator,
+		[]string{"missing", "--output", "json", "--all-workers"},
+		bytes.NewBuffer([]byte{}),
+	)
+
+	s.Equal(1, returnCode)
+	s.Equal("missing", cmd.Subcommand)
+	s.Equal("json", cmd.Output)
+	s.True(cmd.AllWorkers)
+}
+
+func (s *AccountsSuite) TestParsesMissingWorker() {
+	var cmd accounts.Command
+
+	accounts.Execute(
+		func(c accounts.Command) (accounts.Worker, error) {
+			cmd = c
+			return nil, errors.New("no worker")
+		},
+		noopAccountantFactory,
+		noopValidator,
+		[]string{"missing", "--worker", "worker-1"},
+		bytes.NewBuffer([]byte{}),
+	)
+
+	s.Equal("worker-1", cmd.MissingWorker)
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsMissingWithoutAWorkerName() {
+	err := accounts.DefaultValidator(accounts.Command{Subcommand: "missing"})
+
+	s.EqualError(err, "missing needs --worker or --worker-name to know which worker the containers are from")
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsMissingWithMemoryFilter() {
+	err := accounts.DefaultValidator(accounts.Command{
+		Subcommand: "missing",
+		MinMemory:  1024,
+	})
+
+	s.EqualError(err, "--min-memory and --older-than are not supported with missing")
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsSeveralWebNodes() {
+	err := accounts.DefaultValidator(accounts.Command{
+		WebK8sNamespace:    "concourse",
+		WebK8sPod:          "web-0",
+		WebDockerContainer: "concourse_web_1",
+	})
+
+	s.EqualError(err, "--bosh-web-instance, --web-k8s-pod, --web-k8s-deployment, --helm-release, --web-docker-container, --web-env-file and --web-pid cannot be combined")
+}
+
+func (s *AccountsSuite) TestDefaultValidatorRejectsUnknownWebWorkloadKind() {
+	err := accounts.DefaultValidator(accounts.Command{
+		WebK8sNamespace:  "concourse",
+		WebK8sDeployment: "daemonset/web",
+	})
+
+	s.EqualError(err, "--web-k8s-deployment: 'daemonset/web' is not a deployment or statefulset")
+}
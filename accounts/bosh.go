@@ -0,0 +1,185 @@
+package accounts
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/yaml"
+)
+
+// a BoshInstance is a VM in a BOSH deployment, i.e. worker/0 or
+// web/8f1ac5e2-....
+type BoshInstance struct {
+	Deployment string
+	Group      string
+	ID         string
+	Network    string
+}
+
+func ParseBoshInstance(deployment, instance, network string) (BoshInstance, error) {
+	parts := strings.Split(instance, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return BoshInstance{}, fmt.Errorf(
+			"invalid BOSH instance '%s', must be group/index or group/id",
+			instance,
+		)
+	}
+	return BoshInstance{
+		Deployment: deployment,
+		Group:      parts[0],
+		ID:         parts[1],
+		Network:    network,
+	}, nil
+}
+
+// Host is the instance's BOSH DNS name. Instances given by index are looked
+// up with a BOSH DNS query, since only their IDs have names of their own.
+func (bi BoshInstance) Host() string {
+	id := bi.ID
+	if _, err := strconv.Atoi(id); err == nil {
+		id = "q-i" + id
+	}
+	return strings.Join(
+		[]string{id, bi.Group, bi.Network, bi.Deployment, "bosh"},
+		".",
+	)
+}
+
+// a BoshGardenDialer reaches a BOSH-deployed worker's Garden, which usually
+// only listens on the VM's loopback interface, by signing in to the VM
+// through a gateway. Its address is as seen from the VM, defaulting as
+// LANGardenDialer's does.
+type BoshGardenDialer struct {
+	Gateway    SSHHop
+	Instance   BoshInstance
+	Config     *ssh.ClientConfig
+	GardenAddr string
+
+	tunnels sshTunnels
+}
+
+func (bgd *BoshGardenDialer) Dial() (net.Conn, error) {
+	network, addr := gardenNetworkAddr(bgd.GardenAddr)
+	return bgd.tunnels.Dial(bgd.hops(), network, addr)
+}
+
+func (bgd *BoshGardenDialer) hops() []SSHHop {
+	return boshHops(bgd.Gateway, bgd.Instance, bgd.Config)
+}
+
+func boshHops(gateway SSHHop, instance BoshInstance, config *ssh.ClientConfig) []SSHHop {
+	return []SSHHop{
+		gateway,
+		{
+			Addr:   net.JoinHostPort(instance.Host(), "22"),
+			Config: config,
+		},
+	}
+}
+
+// a CommandRunner runs a shell command somewhere and returns its stdout.
+type CommandRunner interface {
+	Output(command string) ([]byte, error)
+}
+
+// an SSHCommandRunner runs commands on the last of its hops.
+type SSHCommandRunner struct {
+	Hops []SSHHop
+}
+
+func (scr *SSHCommandRunner) Output(command string) ([]byte, error) {
+	clients, err := sshConnect(scr.Hops)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSSHClients(clients)
+	session, err := clients[len(clients)-1].NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return session.Output(command)
+}
+
+// the web job's bpm config holds the environment concourse web is started
+// with, which is where the release puts its postgres settings.
+const boshWebConfig = "/var/vcap/jobs/web/config/bpm.yml"
+
+type bpmConfig struct {
+	Processes []struct {
+		Name string            `json:"name"`
+		Env  map[string]string `json:"env"`
+	} `json:"processes"`
+}
+
+// a BoshWebNode infers postgres settings from the config files of a
+// BOSH-deployed web VM.
+type BoshWebNode struct {
+	Runner CommandRunner
+
+	env map[string]string
+}
+
+func (bwn *BoshWebNode) PostgresParamNames() ([]string, error) {
+	env, err := bwn.environment()
+	if err != nil {
+		return nil, err
+	}
+	return postgresParamNames(env), nil
+}
+
+func (bwn *BoshWebNode) ValueFromEnvVar(paramName string) (string, error) {
+	env, err := bwn.environment()
+	if err != nil {
+		return "", err
+	}
+	value, ok := env[paramName]
+	if !ok {
+		return "", fmt.Errorf("web job does not have '%s' specified", paramName)
+	}
+	return value, nil
+}
+
+func (bwn *BoshWebNode) FileContentsFromEnvVar(paramName string) (string, error) {
+	path, err := bwn.ValueFromEnvVar(paramName)
+	if err != nil {
+		return "", err
+	}
+	contents, err := bwn.Runner.Output("sudo cat " + shellQuote(path))
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+func (bwn *BoshWebNode) environment() (map[string]string, error) {
+	if bwn.env != nil {
+		return bwn.env, nil
+	}
+	out, err := bwn.Runner.Output("sudo cat " + boshWebConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config bpmConfig
+	err = yaml.Unmarshal(out, &config)
+	if err != nil {
+		return nil, err
+	}
+	for _, process := range config.Processes {
+		if process.Name == "web" {
+			bwn.env = process.Env
+			if bwn.env == nil {
+				bwn.env = map[string]string{}
+			}
+			return bwn.env, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no web process", boshWebConfig)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
@@ -0,0 +1,201 @@
+package accounts_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/garden/gardenfakes"
+	"code.cloudfoundry.org/garden/server"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/ssh"
+)
+
+type BoshSuite struct {
+	suite.Suite
+	*require.Assertions
+	keyPath    string
+	knownHosts string
+	gateway    *testSSHServer
+	instance   *testSSHServer
+	config     *ssh.ClientConfig
+}
+
+func (s *BoshSuite) SetupTest() {
+	var publicKey ssh.PublicKey
+	var err error
+	s.keyPath, publicKey, err = testSSHKey()
+	s.NoError(err)
+	s.gateway, err = newTestSSHServer(publicKey)
+	s.NoError(err)
+	s.instance, err = newTestSSHServer(publicKey)
+	s.NoError(err)
+	// instances are known by their BOSH DNS names, as seen from the gateway
+	s.knownHosts, err = testKnownHosts(map[string]ssh.PublicKey{
+		s.gateway.Addr():                        s.gateway.hostKey,
+		s.instance.Addr():                       s.instance.hostKey,
+		"q-i0.worker.default.concourse.bosh:22": s.instance.hostKey,
+		"q-i0.web.default.concourse.bosh:22":    s.instance.hostKey,
+	})
+	s.NoError(err)
+	hostKeys, err := accounts.NewHostKeyCallback(s.knownHosts, false)
+	s.NoError(err)
+	s.config, err = accounts.NewSSHClientConfig("vcap", s.keyPath, hostKeys)
+	s.NoError(err)
+}
+
+func (s *BoshSuite) TearDownTest() {
+	s.gateway.Close()
+	s.instance.Close()
+	os.Remove(s.keyPath)
+	os.Remove(s.knownHosts)
+}
+
+func (s *BoshSuite) TestNamesInstancesByIndexWithADNSQuery() {
+	instance, err := accounts.ParseBoshInstance("concourse", "worker/0", "default")
+
+	s.NoError(err)
+	s.Equal("q-i0.worker.default.concourse.bosh", instance.Host())
+}
+
+func (s *BoshSuite) TestNamesInstancesByID() {
+	instance, err := accounts.ParseBoshInstance("concourse", "web/8f1ac5e2", "private")
+
+	s.NoError(err)
+	s.Equal("8f1ac5e2.web.private.concourse.bosh", instance.Host())
+}
+
+func (s *BoshSuite) TestRejectsInstancesWithoutAGroup() {
+	_, err := accounts.ParseBoshInstance("concourse", "worker", "default")
+
+	s.EqualError(err, "invalid BOSH instance 'worker', must be group/index or group/id")
+}
+
+func (s *BoshSuite) TestDialsGardenThroughTheGateway() {
+	backend := new(gardenfakes.FakeBackend)
+	backend.ContainersReturns([]garden.Container{}, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	gardenServer := server.New(
+		"tcp",
+		listener.Addr().String(),
+		0,
+		backend,
+		lagertest.NewTestLogger("test"),
+	)
+	go gardenServer.Serve(listener)
+	defer gardenServer.Stop()
+	s.gateway.routes["q-i0.worker.default.concourse.bosh:22"] = s.instance.Addr()
+	s.instance.routes["127.0.0.1:7777"] = listener.Addr().String()
+	instance, err := accounts.ParseBoshInstance("concourse", "worker/0", "default")
+	s.NoError(err)
+	worker := &accounts.GardenWorker{
+		Dialer: &accounts.BoshGardenDialer{
+			Gateway:  accounts.SSHHop{Addr: s.gateway.Addr(), Config: s.config},
+			Instance: instance,
+			Config:   s.config,
+		},
+	}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, backend.ContainersCallCount())
+}
+
+func (s *BoshSuite) TestSignsInOnceForEveryDial() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	s.gateway.routes["q-i0.worker.default.concourse.bosh:22"] = s.instance.Addr()
+	s.instance.routes["127.0.0.1:7777"] = listener.Addr().String()
+	instance, err := accounts.ParseBoshInstance("concourse", "worker/0", "default")
+	s.NoError(err)
+	dialer := &accounts.BoshGardenDialer{
+		Gateway:  accounts.SSHHop{Addr: s.gateway.Addr(), Config: s.config},
+		Instance: instance,
+		Config:   s.config,
+	}
+
+	for i := 0; i < 3; i++ {
+		conn, err := dialer.Dial()
+		s.NoError(err)
+		conn.Close()
+	}
+
+	s.Equal(1, s.gateway.SignIns())
+	s.Equal(1, s.instance.SignIns())
+	// a lost connection is signed in to again
+	s.gateway.Disconnect()
+	conn, err := dialer.Dial()
+	s.NoError(err)
+	conn.Close()
+	s.Equal(2, s.gateway.SignIns())
+	s.Equal(2, s.instance.SignIns())
+}
+
+func (s *BoshSuite) TestInfersPostgresConfigFromTheWebJob() {
+	s.gateway.routes["q-i0.web.default.concourse.bosh:22"] = s.instance.Addr()
+	s.instance.commands["sudo cat /var/vcap/jobs/web/config/bpm.yml"] = `
+processes:
+- name: web
+  executable: /var/vcap/packages/concourse/bin/concourse
+  args: [web]
+  env:
+    CONCOURSE_POSTGRES_HOST: 10.0.0.5
+    CONCOURSE_POSTGRES_USER: atc
+    CONCOURSE_POSTGRES_CA_CERT: /var/vcap/jobs/web/config/postgres/ca_cert
+    CONCOURSE_EXTERNAL_URL: https://ci.example.com
+`
+	s.instance.commands["sudo cat '/var/vcap/jobs/web/config/postgres/ca_cert'"] = "some-cert"
+	instance, err := accounts.ParseBoshInstance("concourse", "web/0", "default")
+	s.NoError(err)
+	tracker := &accounts.TmpfsTracker{}
+	defer tracker.Clear()
+	opener := &accounts.WebNodeInferredPostgresOpener{
+		WebNode: &accounts.BoshWebNode{
+			Runner: &accounts.SSHCommandRunner{
+				Hops: []accounts.SSHHop{
+					{Addr: s.gateway.Addr(), Config: s.config},
+					{Addr: net.JoinHostPort(instance.Host(), "22"), Config: s.config},
+				},
+			},
+		},
+		FileTracker: tracker,
+	}
+
+	postgresConfig, err := opener.PostgresConfig()
+
+	s.NoError(err)
+	s.Equal("10.0.0.5", postgresConfig.Host)
+	s.Equal("atc", postgresConfig.User)
+	caCert, err := ioutil.ReadFile(postgresConfig.CACert.Path())
+	s.NoError(err)
+	s.Equal("some-cert", string(caCert))
+}
+
+func (s *BoshSuite) TestFailsWithoutAWebProcess() {
+	s.instance.commands["sudo cat /var/vcap/jobs/web/config/bpm.yml"] = "processes: []"
+	webNode := &accounts.BoshWebNode{
+		Runner: &accounts.SSHCommandRunner{
+			Hops: []accounts.SSHHop{{Addr: s.instance.Addr(), Config: s.config}},
+		},
+	}
+
+	_, err := webNode.PostgresParamNames()
+
+	s.EqualError(err, "/var/vcap/jobs/web/config/bpm.yml has no web process")
+}
@@ -3,6 +3,7 @@ package accounts
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/concourse/concourse/atc/db"
@@ -28,15 +29,100 @@ func (bw BuildWorkload) ToString() string {
 	)
 }
 
+func (bw BuildWorkload) Fields() WorkloadFields {
+	return WorkloadFields{
+		Team:     bw.teamName,
+		Pipeline: bw.pipelineName,
+		Job:      bw.jobName,
+		Build:    bw.buildName,
+		Step:     bw.stepName,
+	}
+}
+
+// a OneOffBuildWorkload is a step of a build which belongs to no pipeline or
+// job, i.e. one started with fly execute. Such builds are only known by their
+// ID.
+type OneOffBuildWorkload struct {
+	teamName      string
+	buildID       int
+	stepName      string
+	containerType db.ContainerType
+}
+
+func (obw OneOffBuildWorkload) ToString() string {
+	return fmt.Sprintf("%s/one-off/%d/%s", obw.teamName, obw.buildID, obw.stepName)
+}
+
+func (obw OneOffBuildWorkload) Fields() WorkloadFields {
+	return WorkloadFields{
+		Team:  obw.teamName,
+		Build: strconv.Itoa(obw.buildID),
+		Step:  obw.stepName,
+	}
+}
+
+// an ImageWorkload is a container checking for or fetching the image of a
+// build's step. It is labelled with the build of the step's container.
+type ImageWorkload struct {
+	build         Workload
+	containerType db.ContainerType
+}
+
+func (iw ImageWorkload) ToString() string {
+	return iw.build.ToString() + ":image"
+}
+
+func (iw ImageWorkload) Fields() WorkloadFields {
+	return iw.build.Fields()
+}
+
+// buildWorkload tells which step of which build a container belongs to.
+func buildWorkload(
+	teamName string,
+	metadata db.ContainerMetadata,
+	oneOff bool,
+	instanceVars sql.NullString,
+) (Workload, error) {
+	if oneOff {
+		return OneOffBuildWorkload{
+			teamName:      teamName,
+			buildID:       metadata.BuildID,
+			stepName:      metadata.StepName,
+			containerType: metadata.Type,
+		}, nil
+	}
+	pipelineName, err := pipelineRef(metadata.PipelineName, instanceVars)
+	if err != nil {
+		return nil, err
+	}
+	return BuildWorkload{
+		teamName:      teamName,
+		pipelineName:  pipelineName,
+		jobName:       metadata.JobName,
+		buildName:     metadata.BuildName,
+		stepName:      metadata.StepName,
+		containerType: metadata.Type,
+	}, nil
+}
+
+// one-off builds, i.e. ones started with fly execute, are the ones without a
+// pipeline. Containers whose build has since been deleted are labelled from
+// their metadata alone.
+const oneOffBuild = "b.id IS NOT NULL AND b.pipeline_id IS NULL"
+
 func buildSamples(
 	conn *sql.DB,
 	containers []Container,
+	filter WorkloadFilter,
+	instanceVars string,
 ) ([]Sample, error) {
 	rows, err := sq.StatementBuilder.
 		PlaceholderFormat(sq.Dollar).
 		Select(
 			"c.handle",
 			"t.name",
+			oneOffBuild,
+			instanceVars,
 			"c.meta_type",
 			"c.meta_step_name",
 			"c.meta_attempt",
@@ -51,9 +137,16 @@ func buildSamples(
 		).
 		From("containers c").
 		Join("teams t ON c.team_id = t.id").
+		LeftJoin("builds b ON c.meta_build_id = b.id").
+		LeftJoin("pipelines p ON b.pipeline_id = p.id").
 		Where(sq.And{
 			filterHandles(containers),
 			sq.NotEq{"c.meta_type": db.ContainerTypeCheck},
+			sq.Eq{
+				"c.image_check_container_id": nil,
+				"c.image_get_container_id":   nil,
+			},
+			filter.conditions("t.name", "c.meta_pipeline_name"),
 		}).
 		RunWith(conn).
 		Query()
@@ -61,27 +154,112 @@ func buildSamples(
 		return nil, err
 	}
 
-	workloads := map[string]BuildWorkload{}
+	types := map[string]db.ContainerType{}
+	workloads := map[string]Workload{}
 	defer db.Close(rows)
 	for rows.Next() {
 		var metadata db.ContainerMetadata
 		var handle, teamName string
+		var oneOff bool
+		var pipelineInstanceVars sql.NullString
 		columns := append(
-			[]interface{}{&handle, &teamName},
+			[]interface{}{&handle, &teamName, &oneOff, &pipelineInstanceVars},
 			metadata.ScanTargets()...,
 		)
 		err = rows.Scan(columns...)
 		if err != nil {
 			return nil, err
 		}
-		workloads[handle] = BuildWorkload{
-			teamName:      teamName,
-			pipelineName:  metadata.PipelineName,
-			jobName:       metadata.JobName,
-			buildName:     metadata.BuildName,
-			stepName:      metadata.StepName,
-			containerType: metadata.Type,
+		workload, err := buildWorkload(teamName, metadata, oneOff, pipelineInstanceVars)
+		if err != nil {
+			return nil, err
+		}
+		types[handle] = metadata.Type
+		workloads[handle] = workload
+	}
+
+	var samples []Sample
+	for _, container := range containers {
+		if workload, ok := workloads[container.Handle]; ok {
+			samples = append(samples, Sample{
+				Container: container,
+				Labels: Labels{
+					Type:      types[container.Handle],
+					Workloads: []Workload{workload},
+				},
+			})
+		}
+	}
+
+	return samples, nil
+}
+
+// imageSamples labels the containers fetching images for build steps, whose
+// own metadata only says whether they check or get. The build is found on
+// the container of the step they fetch the image for.
+func imageSamples(
+	conn *sql.DB,
+	containers []Container,
+	filter WorkloadFilter,
+	instanceVars string,
+) ([]Sample, error) {
+	rows, err := sq.StatementBuilder.
+		PlaceholderFormat(sq.Dollar).
+		Select(
+			"c.handle",
+			"c.meta_type",
+			"t.name",
+			oneOffBuild,
+			instanceVars,
+			"pc.meta_type",
+			"pc.meta_step_name",
+			"pc.meta_attempt",
+			"pc.meta_working_directory",
+			"pc.meta_process_user",
+			"pc.meta_pipeline_id",
+			"pc.meta_job_id",
+			"pc.meta_build_id",
+			"pc.meta_pipeline_name",
+			"pc.meta_job_name",
+			"pc.meta_build_name",
+		).
+		From("containers c").
+		Join("containers pc ON pc.id = COALESCE(c.image_check_container_id, c.image_get_container_id)").
+		Join("teams t ON pc.team_id = t.id").
+		LeftJoin("builds b ON pc.meta_build_id = b.id").
+		LeftJoin("pipelines p ON b.pipeline_id = p.id").
+		Where(sq.And{
+			filterHandles(containers),
+			sq.NotEq{"pc.meta_build_id": 0},
+			filter.conditions("t.name", "pc.meta_pipeline_name"),
+		}).
+		RunWith(conn).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+
+	workloads := map[string]ImageWorkload{}
+	defer db.Close(rows)
+	for rows.Next() {
+		var metadata db.ContainerMetadata
+		var handle, teamName string
+		var containerType db.ContainerType
+		var oneOff bool
+		var pipelineInstanceVars sql.NullString
+		columns := append(
+			[]interface{}{&handle, &containerType, &teamName, &oneOff, &pipelineInstanceVars},
+			metadata.ScanTargets()...,
+		)
+		err = rows.Scan(columns...)
+		if err != nil {
+			return nil, err
+		}
+		build, err := buildWorkload(teamName, metadata, oneOff, pipelineInstanceVars)
+		if err != nil {
+			return nil, err
 		}
+		workloads[handle] = ImageWorkload{build: build, containerType: containerType}
 	}
 
 	var samples []Sample
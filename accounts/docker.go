@@ -0,0 +1,274 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultDockerSocket is where the Docker Engine API listens on most hosts.
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// a DockerWebContainer infers postgres settings from a web container run by
+// Docker on this host, i.e. one from concourse's docker-compose.yml. File
+// params are read from the host side of the container's mounts. A postgres
+// host naming another container, which only resolves inside their network,
+// is swapped for where that container is reachable from this host.
+type DockerWebContainer struct {
+	Socket    string
+	Container string
+
+	inspected *dockerContainer
+	env       map[string]string
+}
+
+// dockerContainer is the part of the Engine API's container inspection that
+// is needed here.
+type dockerContainer struct {
+	Name   string `json:"Name"`
+	Config struct {
+		Env []string `json:"Env"`
+	} `json:"Config"`
+	Mounts []struct {
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			NetworkID string   `json:"NetworkID"`
+			IPAddress string   `json:"IPAddress"`
+			Aliases   []string `json:"Aliases"`
+		} `json:"Networks"`
+		Ports map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+// dockerNetwork is the part of the Engine API's network inspection that is
+// needed here.
+type dockerNetwork struct {
+	Containers map[string]struct {
+		Name string `json:"Name"`
+	} `json:"Containers"`
+}
+
+func (dwc *DockerWebContainer) PostgresParamNames() ([]string, error) {
+	env, err := dwc.environment()
+	if err != nil {
+		return nil, err
+	}
+	return postgresParamNames(env), nil
+}
+
+func (dwc *DockerWebContainer) ValueFromEnvVar(paramName string) (string, error) {
+	env, err := dwc.environment()
+	if err != nil {
+		return "", err
+	}
+	value, ok := env[paramName]
+	if !ok {
+		return "", fmt.Errorf(
+			"container '%s' does not have '%s' specified",
+			dwc.Container,
+			paramName,
+		)
+	}
+	return value, nil
+}
+
+func (dwc *DockerWebContainer) FileContentsFromEnvVar(paramName string) (string, error) {
+	path, err := dwc.ValueFromEnvVar(paramName)
+	if err != nil {
+		return "", err
+	}
+	hostPath, err := dwc.hostPath(path)
+	if err != nil {
+		return "", err
+	}
+	contents, err := ioutil.ReadFile(hostPath)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// hostPath finds where a path in the container is on the host, through the
+// mount it is in. When mounts are nested, the innermost one is used.
+func (dwc *DockerWebContainer) hostPath(path string) (string, error) {
+	container, err := dwc.inspect()
+	if err != nil {
+		return "", err
+	}
+	found := false
+	var source, destination string
+	for _, mount := range container.Mounts {
+		rel, err := filepath.Rel(mount.Destination, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if !found || len(mount.Destination) > len(destination) {
+			source, destination = mount.Source, mount.Destination
+			found = true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf(
+			"container '%s' has no mounts containing '%s'",
+			dwc.Container,
+			path,
+		)
+	}
+	rel, _ := filepath.Rel(destination, path)
+	return filepath.Join(source, rel), nil
+}
+
+func (dwc *DockerWebContainer) environment() (map[string]string, error) {
+	if dwc.env != nil {
+		return dwc.env, nil
+	}
+	container, err := dwc.inspect()
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for _, pair := range container.Config.Env {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	if host, ok := env["CONCOURSE_POSTGRES_HOST"]; ok {
+		port, ok := env["CONCOURSE_POSTGRES_PORT"]
+		if !ok {
+			port = "5432"
+		}
+		host, port, found, err := dwc.containerAddr(container, host, port)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			env["CONCOURSE_POSTGRES_HOST"] = host
+			env["CONCOURSE_POSTGRES_PORT"] = port
+		}
+	}
+	dwc.env = env
+	return env, nil
+}
+
+// containerAddr finds where this host reaches port on the container named
+// host on one of the web container's networks: where the port is published
+// or, failing that, the container's IP on the network. It is not found for
+// hosts which aren't such containers.
+func (dwc *DockerWebContainer) containerAddr(web *dockerContainer, host, port string) (string, string, bool, error) {
+	if net.ParseIP(host) != nil {
+		return "", "", false, nil
+	}
+	networkNames := []string{}
+	for name := range web.NetworkSettings.Networks {
+		networkNames = append(networkNames, name)
+	}
+	sort.Strings(networkNames)
+	for _, networkName := range networkNames {
+		network := &dockerNetwork{}
+		err := dwc.get("/networks/"+url.PathEscape(web.NetworkSettings.Networks[networkName].NetworkID), network)
+		if err != nil {
+			return "", "", false, err
+		}
+		ids := []string{}
+		for id := range network.Containers {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			container := &dockerContainer{}
+			err := dwc.get("/containers/"+url.PathEscape(id)+"/json", container)
+			if err != nil {
+				return "", "", false, err
+			}
+			attached := container.NetworkSettings.Networks[networkName]
+			if strings.TrimPrefix(container.Name, "/") != host && !containsString(attached.Aliases, host) {
+				continue
+			}
+			for _, binding := range container.NetworkSettings.Ports[port+"/tcp"] {
+				hostIP := binding.HostIP
+				if hostIP == "" || net.ParseIP(hostIP).IsUnspecified() {
+					hostIP = "127.0.0.1"
+				}
+				return hostIP, binding.HostPort, true, nil
+			}
+			if attached.IPAddress == "" {
+				return "", "", false, fmt.Errorf(
+					"container '%s' has no address on network '%s'",
+					host,
+					networkName,
+				)
+			}
+			return attached.IPAddress, port, true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, candidate := range values {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (dwc *DockerWebContainer) inspect() (*dockerContainer, error) {
+	if dwc.inspected != nil {
+		return dwc.inspected, nil
+	}
+	container := &dockerContainer{}
+	err := dwc.get("/containers/"+url.PathEscape(dwc.Container)+"/json", container)
+	if err != nil {
+		return nil, err
+	}
+	dwc.inspected = container
+	return container, nil
+}
+
+// get decodes the Engine API's response to a GET of path into v.
+func (dwc *DockerWebContainer) get(path string, v interface{}) error {
+	socket := dwc.Socket
+	if socket == "" {
+		socket = DefaultDockerSocket
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	// the host is ignored, everything goes to the socket
+	response, err := client.Get("http://docker" + path)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(response.Body).Decode(&apiError)
+		if apiError.Message == "" {
+			apiError.Message = response.Status
+		}
+		return fmt.Errorf("docker: %s", apiError.Message)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
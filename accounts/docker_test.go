@@ -0,0 +1,200 @@
+package accounts_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DockerSuite struct {
+	suite.Suite
+	*require.Assertions
+	dir        string
+	server     *httptest.Server
+	containers map[string]interface{}
+	networks   map[string]interface{}
+}
+
+// SetupTest serves the container and network inspection endpoints of the
+// Docker Engine API on a unix socket, for s.containers and s.networks.
+func (s *DockerSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "ft-docker")
+	s.NoError(err)
+	s.containers = map[string]interface{}{}
+	s.networks = map[string]interface{}{}
+	listener, err := net.Listen("unix", filepath.Join(s.dir, "docker.sock"))
+	s.NoError(err)
+	s.server = &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if filepath.Dir(r.URL.Path) == "/networks" {
+				network, ok := s.networks[filepath.Base(r.URL.Path)]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(map[string]string{
+						"message": "network not found",
+					})
+					return
+				}
+				json.NewEncoder(w).Encode(network)
+				return
+			}
+			name := filepath.Base(filepath.Dir(r.URL.Path))
+			container, ok := s.containers[name]
+			if !ok || filepath.Base(r.URL.Path) != "json" {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{
+					"message": "No such container: " + name,
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(container)
+		})},
+	}
+	s.server.Start()
+}
+
+func (s *DockerSuite) TearDownTest() {
+	s.server.Close()
+	os.RemoveAll(s.dir)
+}
+
+func (s *DockerSuite) webContainer() *accounts.DockerWebContainer {
+	return &accounts.DockerWebContainer{
+		Socket:    filepath.Join(s.dir, "docker.sock"),
+		Container: "concourse_web_1",
+	}
+}
+
+func (s *DockerSuite) TestInfersPostgresConfigFromTheContainer() {
+	keys := filepath.Join(s.dir, "keys")
+	s.NoError(os.MkdirAll(filepath.Join(keys, "postgres"), 0700))
+	s.NoError(ioutil.WriteFile(filepath.Join(keys, "postgres", "ca.crt"), []byte("some-cert"), 0600))
+	s.containers["concourse_web_1"] = map[string]interface{}{
+		"Config": map[string]interface{}{
+			"Env": []string{
+				"CONCOURSE_POSTGRES_HOST=db",
+				"CONCOURSE_POSTGRES_USER=dev",
+				"CONCOURSE_POSTGRES_PASSWORD=dev=pass",
+				"CONCOURSE_POSTGRES_CA_CERT=/concourse-keys/postgres/ca.crt",
+				"CONCOURSE_EXTERNAL_URL=http://localhost:8080",
+			},
+		},
+		"Mounts": []map[string]string{
+			{"Source": "/somewhere/else", "Destination": "/data"},
+			{"Source": keys, "Destination": "/concourse-keys"},
+		},
+	}
+	tracker := &accounts.TmpfsTracker{}
+	defer tracker.Clear()
+	opener := &accounts.WebNodeInferredPostgresOpener{
+		WebNode:     s.webContainer(),
+		FileTracker: tracker,
+	}
+
+	postgresConfig, err := opener.PostgresConfig()
+
+	s.NoError(err)
+	s.Equal("db", postgresConfig.Host)
+	s.Equal("dev", postgresConfig.User)
+	s.Equal("dev=pass", postgresConfig.Password)
+	caCert, err := ioutil.ReadFile(postgresConfig.CACert.Path())
+	s.NoError(err)
+	s.Equal("some-cert", string(caCert))
+}
+
+// composeContainers puts a web and a db container on a compose network, with
+// the db's postgres port published on the host at publishedPort unless it is
+// empty.
+func (s *DockerSuite) composeContainers(publishedPort string) {
+	network := func(ip string, aliases ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"concourse_default": map[string]interface{}{
+				"NetworkID": "some-network-id",
+				"IPAddress": ip,
+				"Aliases":   aliases,
+			},
+		}
+	}
+	s.containers["concourse_web_1"] = map[string]interface{}{
+		"Name": "/concourse_web_1",
+		"Config": map[string]interface{}{
+			"Env": []string{
+				"CONCOURSE_POSTGRES_HOST=db",
+				"CONCOURSE_POSTGRES_USER=dev",
+			},
+		},
+		"NetworkSettings": map[string]interface{}{
+			"Networks": network("172.18.0.3", "web", "4f1e2d3c"),
+		},
+	}
+	ports := map[string]interface{}{}
+	if publishedPort != "" {
+		ports["5432/tcp"] = []map[string]string{
+			{"HostIp": "0.0.0.0", "HostPort": publishedPort},
+		}
+	}
+	s.containers["db-id"] = map[string]interface{}{
+		"Name": "/concourse_db_1",
+		"NetworkSettings": map[string]interface{}{
+			"Networks": network("172.18.0.2", "db", "9a8b7c6d"),
+			"Ports":    ports,
+		},
+	}
+	s.containers["web-id"] = s.containers["concourse_web_1"]
+	s.networks["some-network-id"] = map[string]interface{}{
+		"Containers": map[string]interface{}{
+			"web-id": map[string]string{"Name": "concourse_web_1"},
+			"db-id":  map[string]string{"Name": "concourse_db_1"},
+		},
+	}
+}
+
+func (s *DockerSuite) TestReachesTheDBContainerAtItsPublishedPort() {
+	s.composeContainers("6543")
+	opener := &accounts.WebNodeInferredPostgresOpener{WebNode: s.webContainer()}
+
+	postgresConfig, err := opener.PostgresConfig()
+
+	s.NoError(err)
+	s.Equal("127.0.0.1", postgresConfig.Host)
+	s.Equal(uint16(6543), postgresConfig.Port)
+}
+
+func (s *DockerSuite) TestReachesAnUnpublishedDBContainerAtItsIP() {
+	s.composeContainers("")
+	opener := &accounts.WebNodeInferredPostgresOpener{WebNode: s.webContainer()}
+
+	postgresConfig, err := opener.PostgresConfig()
+
+	s.NoError(err)
+	s.Equal("172.18.0.2", postgresConfig.Host)
+	s.Equal(uint16(5432), postgresConfig.Port)
+}
+
+func (s *DockerSuite) TestFailsForFilesOutsideMounts() {
+	s.containers["concourse_web_1"] = map[string]interface{}{
+		"Config": map[string]interface{}{
+			"Env": []string{"CONCOURSE_POSTGRES_CA_CERT=/keys/ca.crt"},
+		},
+	}
+
+	_, err := s.webContainer().FileContentsFromEnvVar("CONCOURSE_POSTGRES_CA_CERT")
+
+	s.EqualError(err, "container 'concourse_web_1' has no mounts containing '/keys/ca.crt'")
+}
+
+func (s *DockerSuite) TestFailsForUnknownContainers() {
+	_, err := s.webContainer().PostgresParamNames()
+
+	s.EqualError(err, "docker: No such container: concourse_web_1")
+}
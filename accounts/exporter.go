@@ -0,0 +1,177 @@
+package accounts
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var exporterLabels = []string{
+	"team",
+	"pipeline",
+	"job",
+	"build",
+	"step",
+	"resource",
+	"type",
+	"handle",
+	"worker",
+}
+
+// an Exporter serves prometheus gauges with the latest accounting of a
+// worker's containers. A container with several workloads (i.e. a check
+// container shared between resources) is exported once per workload.
+type Exporter struct {
+	Worker       Worker
+	Accountant   Accountant
+	StatsOptions []StatsOption
+
+	registry *prometheus.Registry
+	memory   *prometheus.Desc
+	age      *prometheus.Desc
+
+	// the metrics of the last completed refresh, swapped in whole so that
+	// scrapes never see a half-built set
+	lock    sync.RWMutex
+	metrics []prometheus.Metric
+}
+
+func NewExporter(worker Worker, accountant Accountant, opts ...StatsOption) *Exporter {
+	exporter := &Exporter{
+		Worker:       worker,
+		Accountant:   accountant,
+		StatsOptions: opts,
+		registry:     prometheus.NewRegistry(),
+		memory: prometheus.NewDesc(
+			"ft_container_memory_bytes",
+			"Memory used by a container, including cache and swap",
+			exporterLabels,
+			nil,
+		),
+		age: prometheus.NewDesc(
+			"ft_container_age_seconds",
+			"Time since a container was created",
+			exporterLabels,
+			nil,
+		),
+	}
+	exporter.registry.MustRegister(exporter)
+	return exporter
+}
+
+func (e *Exporter) Describe(descs chan<- *prometheus.Desc) {
+	descs <- e.memory
+	descs <- e.age
+}
+
+func (e *Exporter) Collect(metrics chan<- prometheus.Metric) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for _, metric := range e.metrics {
+		metrics <- metric
+	}
+}
+
+// Refresh re-accounts the worker's containers and replaces every exported
+// series, so containers which have gone away stop being reported. When some
+// of several workers fail, the rest are still exported and the failures are
+// returned.
+func (e *Exporter) Refresh() error {
+	containers, err := e.Worker.Containers(e.StatsOptions...)
+	workerErrors, partial := err.(WorkerErrors)
+	if err != nil && !partial {
+		return fmt.Errorf("worker error: %s", err.Error())
+	}
+	samples, err := e.Accountant.Account(containers)
+	if err != nil {
+		return fmt.Errorf("accountant error: %s", err.Error())
+	}
+	metrics := []prometheus.Metric{}
+	seen := map[string]bool{}
+	for _, sample := range samples {
+		for _, values := range exporterLabelValues(sample) {
+			// a series may only be collected once
+			key := strings.Join(values, "\x00")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			stats := sample.Container.Stats
+			metrics = append(
+				metrics,
+				prometheus.MustNewConstMetric(e.memory, prometheus.GaugeValue, float64(stats.Memory), values...),
+				prometheus.MustNewConstMetric(e.age, prometheus.GaugeValue, stats.Age.Seconds(), values...),
+			)
+		}
+	}
+	e.lock.Lock()
+	e.metrics = metrics
+	e.lock.Unlock()
+	if partial {
+		return fmt.Errorf("worker error: %s", workerErrors.Error())
+	}
+	return nil
+}
+
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// exporterLabelValues gives the values of exporterLabels for each of a
+// sample's workloads.
+func exporterLabelValues(sample Sample) [][]string {
+	values := [][]string{}
+	for _, workload := range sample.Labels.Workloads {
+		fields := workload.Fields()
+		values = append(values, []string{
+			fields.Team,
+			fields.Pipeline,
+			fields.Job,
+			fields.Build,
+			fields.Step,
+			fields.Resource,
+			string(sample.Labels.Type),
+			sample.Container.Handle,
+			sample.Labels.Worker,
+		})
+	}
+	if len(values) == 0 {
+		values = append(values, []string{
+			"",
+			"",
+			"",
+			"",
+			"",
+			"",
+			string(sample.Labels.Type),
+			sample.Container.Handle,
+			sample.Labels.Worker,
+		})
+	}
+	return values
+}
+
+func serve(stdout io.Writer, cmd Command, worker Worker, accountant Accountant) int {
+	exporter := NewExporter(worker, accountant, statsOptions(cmd)...)
+	go func() {
+		for {
+			err := exporter.Refresh()
+			if err != nil {
+				fmt.Fprintln(stdout, err.Error())
+			}
+			time.Sleep(cmd.Interval)
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter.Handler())
+	fmt.Fprintf(stdout, "serving metrics on %s/metrics\n", cmd.Listen)
+	err := http.ListenAndServe(cmd.Listen, mux)
+	fmt.Fprintf(stdout, "server error: %s\n", err.Error())
+	return 1
+}
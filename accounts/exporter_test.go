@@ -0,0 +1,130 @@
+package accounts_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+
+	"github.com/concourse/concourse/atc/db"
+	"github.com/concourse/ft/accounts"
+	"github.com/concourse/ft/accounts/accountsfakes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExporterSuite struct {
+	suite.Suite
+	*require.Assertions
+	worker     *accountsfakes.FakeWorker
+	accountant *accountsfakes.FakeAccountant
+	exporter   *accounts.Exporter
+	server     *httptest.Server
+}
+
+func (s *ExporterSuite) SetupTest() {
+	s.worker = new(accountsfakes.FakeWorker)
+	s.accountant = new(accountsfakes.FakeAccountant)
+	s.exporter = accounts.NewExporter(s.worker, s.accountant)
+	s.server = httptest.NewServer(s.exporter.Handler())
+}
+
+func (s *ExporterSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *ExporterSuite) scrape() string {
+	resp, err := s.server.Client().Get(s.server.URL)
+	s.NoError(err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	s.NoError(err)
+	return string(body)
+}
+
+func (s *ExporterSuite) TestExportsMemoryPerWorkload() {
+	s.accountant.AccountReturns([]accounts.Sample{
+		{
+			Container: accounts.Container{
+				Handle: "abc123",
+				Stats:  accounts.Stats{Memory: 1024},
+			},
+			Labels: accounts.Labels{
+				Type: db.ContainerTypeTask,
+				Workloads: []accounts.Workload{
+					testWorkload{accounts.WorkloadFields{
+						Team:     "main",
+						Pipeline: "p",
+						Job:      "j",
+						Build:    "1",
+						Step:     "s",
+					}},
+				},
+			},
+		},
+	}, nil)
+
+	s.NoError(s.exporter.Refresh())
+
+	s.Contains(
+		s.scrape(),
+		`ft_container_memory_bytes{build="1",handle="abc123",job="j",pipeline="p",resource="",step="s",team="main",type="task",worker=""} 1024`,
+	)
+}
+
+func (s *ExporterSuite) TestForgetsContainersThatGoAway() {
+	s.accountant.AccountReturnsOnCall(0, []accounts.Sample{
+		{Container: accounts.Container{Handle: "abc123"}},
+	}, nil)
+	s.accountant.AccountReturnsOnCall(1, []accounts.Sample{}, nil)
+
+	s.NoError(s.exporter.Refresh())
+	s.Contains(s.scrape(), `handle="abc123"`)
+	s.NoError(s.exporter.Refresh())
+	s.NotContains(s.scrape(), `handle="abc123"`)
+}
+
+func (s *ExporterSuite) TestRefreshReportsWorkerErrors() {
+	s.worker.ContainersReturns(nil, errors.New("pod not found"))
+
+	err := s.exporter.Refresh()
+
+	s.EqualError(err, "worker error: pod not found")
+}
+
+func (s *ExporterSuite) TestExportsTheWorkersThatAnswered() {
+	s.worker.ContainersReturns(
+		[]accounts.Container{{Handle: "abc123", Worker: "worker-1"}},
+		accounts.WorkerErrors{"worker-2": errors.New("connection refused")},
+	)
+	s.accountant.AccountStub = func(containers []accounts.Container) ([]accounts.Sample, error) {
+		return []accounts.Sample{{
+			Container: containers[0],
+			Labels:    accounts.Labels{Worker: containers[0].Worker},
+		}}, nil
+	}
+
+	err := s.exporter.Refresh()
+
+	s.EqualError(err, "worker error: worker-2: connection refused")
+	s.Contains(s.scrape(), `handle="abc123"`)
+	s.Contains(s.scrape(), `worker="worker-1"`)
+}
+
+func (s *ExporterSuite) TestKeepsServingLastSamplesWhileRefreshing() {
+	s.accountant.AccountReturnsOnCall(0, []accounts.Sample{
+		{Container: accounts.Container{Handle: "abc123"}},
+	}, nil)
+	s.NoError(s.exporter.Refresh())
+
+	var duringRefresh string
+	s.accountant.AccountStub = func([]accounts.Container) ([]accounts.Sample, error) {
+		duringRefresh = s.scrape()
+		return []accounts.Sample{
+			{Container: accounts.Container{Handle: "def456"}},
+		}, nil
+	}
+	s.NoError(s.exporter.Refresh())
+
+	s.Contains(duringRefresh, `handle="abc123"`)
+	s.Contains(s.scrape(), `handle="def456"`)
+}
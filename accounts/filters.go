@@ -0,0 +1,179 @@
+package accounts
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/c2h5oh/datasize"
+)
+
+// SortChoices are the values accepted by the --sort flag.
+var SortChoices = []string{"memory", "cpu", "disk", "age", "handle", "workload"}
+
+// TypeChoices are the values accepted by the --type flag.
+var TypeChoices = []string{"check", "get", "put", "task", string(ContainerTypeUnaccounted)}
+
+// a WorkloadFilter restricts accounting to the given teams and pipelines. It
+// is applied in the database queries, so containers belonging to other teams
+// and pipelines are never labelled. Empty fields match everything.
+type WorkloadFilter struct {
+	Teams     []string
+	Pipelines []string
+}
+
+func (wf WorkloadFilter) conditions(teamColumn, pipelineColumn string) sq.And {
+	conditions := sq.And{}
+	if len(wf.Teams) > 0 {
+		conditions = append(conditions, sq.Eq{teamColumn: wf.Teams})
+	}
+	if len(wf.Pipelines) > 0 {
+		conditions = append(conditions, sq.Eq{pipelineColumn: wf.Pipelines})
+	}
+	return conditions
+}
+
+// matches applies the filter to workloads which were already labelled, i.e.
+// ones read back from snapshots. Instances of a pipeline match its name.
+func (wf WorkloadFilter) matches(fields WorkloadFields) bool {
+	return matchesAny(wf.Teams, fields.Team, false) &&
+		matchesAny(wf.Pipelines, fields.Pipeline, true)
+}
+
+func matchesAny(values []string, value string, instanced bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if value == v || instanced && strings.HasPrefix(value, v+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// a FilteredWorker drops containers whose stats fall below the given
+// thresholds before they are accounted for. The partial results of a
+// WorkerPool are filtered and passed on with their WorkerErrors.
+type FilteredWorker struct {
+	Worker    Worker
+	MinMemory uint64
+	OlderThan time.Duration
+}
+
+func (fw *FilteredWorker) Containers(opts ...StatsOption) ([]Container, error) {
+	containers, err := fw.Worker.Containers(opts...)
+	if _, partial := err.(WorkerErrors); err != nil && !partial {
+		return nil, err
+	}
+	filtered := []Container{}
+	for _, container := range containers {
+		if container.Stats.Memory < fw.MinMemory {
+			continue
+		}
+		if container.Stats.Age < fw.OlderThan {
+			continue
+		}
+		filtered = append(filtered, container)
+	}
+	return filtered, err
+}
+
+// a FilteredAccountant only keeps samples with one of the given container
+// types.
+type FilteredAccountant struct {
+	Accountant Accountant
+	Types      []string
+}
+
+func (fa *FilteredAccountant) Account(containers []Container) ([]Sample, error) {
+	samples, err := fa.Accountant.Account(containers)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []Sample{}
+	for _, sample := range samples {
+		for _, t := range fa.Types {
+			if string(sample.Labels.Type) == t {
+				filtered = append(filtered, sample)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// SortSamples orders samples by the given field. Memory, CPU, disk and age
+// sort largest first, handles and workloads sort alphabetically.
+func SortSamples(samples []Sample, by string, reverse bool) {
+	var less func(a, b Sample) bool
+	switch by {
+	case "memory":
+		less = func(a, b Sample) bool {
+			return a.Container.Stats.Memory > b.Container.Stats.Memory
+		}
+	case "cpu":
+		less = func(a, b Sample) bool {
+			return a.Container.Stats.CPUPercent > b.Container.Stats.CPUPercent
+		}
+	case "disk":
+		less = func(a, b Sample) bool {
+			return a.Container.Stats.Disk > b.Container.Stats.Disk
+		}
+	case "age":
+		less = func(a, b Sample) bool {
+			return a.Container.Stats.Age > b.Container.Stats.Age
+		}
+	case "handle":
+		less = func(a, b Sample) bool {
+			return a.Container.Handle < b.Container.Handle
+		}
+	case "workload":
+		less = func(a, b Sample) bool {
+			return workloadString(a) < workloadString(b)
+		}
+	default:
+		return
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		if reverse {
+			return less(samples[j], samples[i])
+		}
+		return less(samples[i], samples[j])
+	})
+}
+
+func workloadString(sample Sample) string {
+	workloads := []string{}
+	for _, w := range sample.Labels.Workloads {
+		workloads = append(workloads, w.ToString())
+	}
+	return strings.Join(workloads, ",")
+}
+
+// byteSizeValue lets a flag be given as a human readable size like 500MB.
+type byteSizeValue struct {
+	size *uint64
+}
+
+func (bsv byteSizeValue) String() string {
+	if bsv.size == nil || *bsv.size == 0 {
+		return "0"
+	}
+	return humanReadable(*bsv.size)
+}
+
+func (bsv byteSizeValue) Set(s string) error {
+	var size datasize.ByteSize
+	err := size.UnmarshalText([]byte(s))
+	if err != nil {
+		return err
+	}
+	*bsv.size = size.Bytes()
+	return nil
+}
+
+func (bsv byteSizeValue) Type() string {
+	return "size"
+}
@@ -0,0 +1,139 @@
+package accounts_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/concourse/concourse/atc/db"
+	"github.com/concourse/ft/accounts"
+	"github.com/concourse/ft/accounts/accountsfakes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type FiltersSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *FiltersSuite) TestFilteredWorkerDropsSmallAndYoungContainers() {
+	fakeWorker := new(accountsfakes.FakeWorker)
+	fakeWorker.ContainersReturns([]accounts.Container{
+		{Handle: "small", Stats: accounts.Stats{Memory: 10, Age: time.Hour}},
+		{Handle: "young", Stats: accounts.Stats{Memory: 1000, Age: time.Minute}},
+		{Handle: "both", Stats: accounts.Stats{Memory: 1000, Age: time.Hour}},
+	}, nil)
+	worker := &accounts.FilteredWorker{
+		Worker:    fakeWorker,
+		MinMemory: 100,
+		OlderThan: 10 * time.Minute,
+	}
+
+	containers, err := worker.Containers()
+
+	s.NoError(err)
+	s.Len(containers, 1)
+	s.Equal("both", containers[0].Handle)
+}
+
+func (s *FiltersSuite) TestFilteredAccountantKeepsMatchingTypes() {
+	fakeAccountant := new(accountsfakes.FakeAccountant)
+	fakeAccountant.AccountReturns([]accounts.Sample{
+		{Labels: accounts.Labels{Type: db.ContainerTypeCheck}},
+		{Labels: accounts.Labels{Type: db.ContainerTypeTask}},
+		{Labels: accounts.Labels{Type: db.ContainerTypeGet}},
+	}, nil)
+	accountant := &accounts.FilteredAccountant{
+		Accountant: fakeAccountant,
+		Types:      []string{"task", "get"},
+	}
+
+	samples, err := accountant.Account(nil)
+
+	s.NoError(err)
+	s.Len(samples, 2)
+	s.Equal(db.ContainerTypeTask, samples[0].Labels.Type)
+	s.Equal(db.ContainerTypeGet, samples[1].Labels.Type)
+}
+
+func (s *FiltersSuite) TestSortsByMemoryLargestFirst() {
+	samples := []accounts.Sample{
+		{Container: accounts.Container{Handle: "a", Stats: accounts.Stats{Memory: 1}}},
+		{Container: accounts.Container{Handle: "b", Stats: accounts.Stats{Memory: 3}}},
+		{Container: accounts.Container{Handle: "c", Stats: accounts.Stats{Memory: 2}}},
+	}
+
+	accounts.SortSamples(samples, "memory", false)
+
+	s.Equal("b", samples[0].Container.Handle)
+	s.Equal("c", samples[1].Container.Handle)
+	s.Equal("a", samples[2].Container.Handle)
+}
+
+func (s *FiltersSuite) TestReversesSortOrder() {
+	samples := []accounts.Sample{
+		{Container: accounts.Container{Handle: "b"}},
+		{Container: accounts.Container{Handle: "a"}},
+		{Container: accounts.Container{Handle: "c"}},
+	}
+
+	accounts.SortSamples(samples, "handle", true)
+
+	s.Equal("c", samples[0].Container.Handle)
+	s.Equal("b", samples[1].Container.Handle)
+	s.Equal("a", samples[2].Container.Handle)
+}
+
+func (s *FiltersSuite) TestParsesFilterFlags() {
+	var cmd accounts.Command
+
+	accounts.Execute(
+		func(c accounts.Command) (accounts.Worker, error) {
+			cmd = c
+			return nil, errors.New("no worker")
+		},
+		noopAccountantFactory,
+		noopValidator,
+		[]string{
+			"--min-memory", "500MB",
+			"--older-than", "2h",
+			"--team", "main,other",
+			"--pipeline", "p",
+			"--type", "task",
+		},
+		bytes.NewBuffer([]byte{}),
+	)
+
+	s.Equal(uint64(500*1024*1024), cmd.MinMemory)
+	s.Equal(2*time.Hour, cmd.OlderThan)
+	s.Equal([]string{"main", "other"}, cmd.Teams)
+	s.Equal([]string{"p"}, cmd.Pipelines)
+	s.Equal([]string{"task"}, cmd.Types)
+}
+
+func (s *FiltersSuite) TestFiltersContainersBeforeAccounting() {
+	fakeWorker := new(accountsfakes.FakeWorker)
+	fakeWorker.ContainersReturns([]accounts.Container{
+		{Handle: "small", Stats: accounts.Stats{Memory: 10}},
+		{Handle: "big", Stats: accounts.Stats{Memory: 1024 * 1024}},
+	}, nil)
+	fakeAccountant := new(accountsfakes.FakeAccountant)
+
+	accounts.Execute(
+		func(accounts.Command) (accounts.Worker, error) {
+			return fakeWorker, nil
+		}, func(accounts.Command) (accounts.Accountant, error) {
+			return fakeAccountant, nil
+		},
+		noopValidator,
+		[]string{"--min-memory", "1KB"},
+		bytes.NewBuffer([]byte{}),
+	)
+
+	s.Equal(1, fakeAccountant.AccountCallCount())
+	s.Equal(
+		[]accounts.Container{{Handle: "big", Stats: accounts.Stats{Memory: 1024 * 1024}}},
+		fakeAccountant.AccountArgsForCall(0),
+	)
+}
@@ -0,0 +1,141 @@
+package accounts
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// a WebDialer reaches addresses on web nodes which can't be dialed directly,
+// i.e. those of web pods.
+type WebDialer interface {
+	DialWeb(addr string) (net.Conn, error)
+}
+
+// a ForwardedWorkerDialer reaches a worker registered through TSA at the
+// address its Garden is forwarded to on a web node, which
+// it looks up by the worker's name. When Web is set, the forwarded ports are
+// reached through it rather than dialed directly.
+type ForwardedWorkerDialer struct {
+	Opener     PostgresOpener
+	WorkerName string
+	Web        WebDialer
+
+	lookup sync.Mutex
+	worker *RegisteredWorker
+}
+
+func (fwd *ForwardedWorkerDialer) Dial() (net.Conn, error) {
+	worker, err := fwd.registeredWorker()
+	if err != nil {
+		return nil, err
+	}
+	if worker.GardenAddr == "" {
+		return nil, fmt.Errorf(
+			"worker '%s' has no garden address, it is %s",
+			fwd.WorkerName,
+			worker.State,
+		)
+	}
+	return fwd.dial(worker.GardenAddr)
+}
+
+func (fwd *ForwardedWorkerDialer) dial(addr string) (net.Conn, error) {
+	if fwd.Web == nil {
+		return net.Dial("tcp", addr)
+	}
+	return fwd.Web.DialWeb(addr)
+}
+
+// garden dials for every request it makes, so the worker is only looked up
+// once.
+func (fwd *ForwardedWorkerDialer) registeredWorker() (*RegisteredWorker, error) {
+	fwd.lookup.Lock()
+	defer fwd.lookup.Unlock()
+	if fwd.worker != nil {
+		return fwd.worker, nil
+	}
+	conn, err := fwd.Opener.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	workers, err := registeredWorkers(conn, sq.Eq{"w.name": fwd.WorkerName})
+	if err != nil {
+		return nil, err
+	}
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("worker '%s' is not registered", fwd.WorkerName)
+	}
+	fwd.worker = &workers[0]
+	return fwd.worker, nil
+}
+
+// a K8sWebPodDialer reaches an address on a web pod by port-forwarding to the
+// one of Pods with the address's IP, which is the pod a worker's ports are
+// forwarded on.
+type K8sWebPodDialer struct {
+	RESTConfig *rest.Config
+	Namespace  string
+	Pods       func() ([]corev1.Pod, error)
+
+	lookup sync.Mutex
+	pods   map[string]string
+}
+
+func (kwpd *K8sWebPodDialer) DialWeb(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	pod, err := kwpd.PodWithIP(host)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &K8sGardenDialer{
+		RESTConfig: kwpd.RESTConfig,
+		Namespace:  kwpd.Namespace,
+		PodName:    pod,
+	}
+	return dialer.DialPort(port)
+}
+
+// PodWithIP names the web pod with the given IP. Like the worker, pods are
+// only looked up the first time an IP is dialed.
+func (kwpd *K8sWebPodDialer) PodWithIP(ip string) (string, error) {
+	kwpd.lookup.Lock()
+	defer kwpd.lookup.Unlock()
+	if pod, ok := kwpd.pods[ip]; ok {
+		return pod, nil
+	}
+	pods, err := kwpd.Pods()
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods {
+		if podHasIP(pod, ip) {
+			if kwpd.pods == nil {
+				kwpd.pods = map[string]string{}
+			}
+			kwpd.pods[ip] = pod.Name
+			return pod.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no web pod has the IP %s the worker is forwarded to", ip)
+}
+
+func podHasIP(pod corev1.Pod, ip string) bool {
+	if pod.Status.PodIP == ip {
+		return true
+	}
+	for _, podIP := range pod.Status.PodIPs {
+		if podIP.IP == ip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package accounts
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/concourse/concourse/fly/ui"
+	"github.com/fatih/color"
+)
+
+// GroupByChoices are the values accepted by the --group-by flag.
+var GroupByChoices = []string{"team", "pipeline", "job", "resource", "type", "worker"}
+
+// samples whose workloads don't have the requested field (i.e. check
+// containers when grouping by job) are collected under this key.
+const noGroup = "none"
+
+type Group struct {
+	Key         string
+	Containers  int
+	TotalMemory uint64
+	MaxMemory   uint64
+	OldestAge   time.Duration
+}
+
+func (g *Group) add(sample Sample, memory uint64) {
+	g.Containers++
+	g.TotalMemory += memory
+	if memory > g.MaxMemory {
+		g.MaxMemory = memory
+	}
+	if sample.Container.Stats.Age > g.OldestAge {
+		g.OldestAge = sample.Container.Stats.Age
+	}
+}
+
+// GroupSamples rolls samples up by the given dimension, largest total memory
+// first. A sample with several workloads (i.e. a check container shared by
+// multiple resources) counts towards each distinct group its workloads fall
+// into.
+func GroupSamples(by string, samples []Sample) ([]Group, error) {
+	return groupSamples(by, samples, false)
+}
+
+// SplitGroupSamples rolls samples up like GroupSamples, except that a shared
+// container's memory is divided between its workloads, so that each group
+// only gets its share and the totals add up to what the containers use.
+func SplitGroupSamples(by string, samples []Sample) ([]Group, error) {
+	return groupSamples(by, samples, true)
+}
+
+func groupSamples(by string, samples []Sample, split bool) ([]Group, error) {
+	groups := map[string]*Group{}
+	for _, sample := range samples {
+		keys, shares, err := groupKeys(by, sample)
+		if err != nil {
+			return nil, err
+		}
+		var memoryShares []uint64
+		// containers without workloads are entirely down to nobody in
+		// particular
+		if split && len(sample.Labels.Workloads) > 0 {
+			weights := []int{}
+			for _, key := range keys {
+				weights = append(weights, shares[key])
+			}
+			memoryShares = divideMemory(sample.Container.Stats.Memory, weights)
+		}
+		for i, key := range keys {
+			if _, ok := groups[key]; !ok {
+				groups[key] = &Group{Key: key}
+			}
+			memory := sample.Container.Stats.Memory
+			if memoryShares != nil {
+				memory = memoryShares[i]
+			}
+			groups[key].add(sample, memory)
+		}
+	}
+	result := []Group{}
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalMemory != result[j].TotalMemory {
+			return result[i].TotalMemory > result[j].TotalMemory
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, nil
+}
+
+// groupKeys returns the distinct groups a sample falls into, along with how
+// many of its workloads fall into each.
+func groupKeys(by string, sample Sample) ([]string, map[string]int, error) {
+	if by == "type" || by == "worker" {
+		// every workload of a container has its type and worker
+		key := string(sample.Labels.Type)
+		if by == "worker" {
+			key = sample.Labels.Worker
+			if key == "" {
+				key = noGroup
+			}
+		}
+		return []string{key}, map[string]int{key: len(sample.Labels.Workloads)}, nil
+	}
+	keys := []string{}
+	shares := map[string]int{}
+	for _, workload := range sample.Labels.Workloads {
+		key, err := groupKey(by, workload.Fields())
+		if err != nil {
+			return nil, nil, err
+		}
+		if shares[key] == 0 {
+			keys = append(keys, key)
+		}
+		shares[key]++
+	}
+	if len(keys) == 0 {
+		keys = append(keys, noGroup)
+	}
+	return keys, shares, nil
+}
+
+// divideMemory divides a container's memory between its sharers, in
+// proportion to their weights, i.e. how many of its workloads are theirs.
+// Bytes which don't divide evenly go to the first sharer, so that the shares
+// add up to the container's memory.
+func divideMemory(memory uint64, weights []int) []uint64 {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	shares := []uint64{}
+	remainder := memory
+	for _, weight := range weights {
+		share := memory * uint64(weight) / uint64(total)
+		shares = append(shares, share)
+		remainder -= share
+	}
+	shares[0] += remainder
+	return shares
+}
+
+func groupKey(by string, fields WorkloadFields) (string, error) {
+	var parts []string
+	switch by {
+	case "team":
+		parts = []string{fields.Team}
+	case "pipeline":
+		parts = []string{fields.Team, fields.Pipeline}
+	case "job":
+		if fields.Job == "" {
+			return noGroup, nil
+		}
+		parts = []string{fields.Team, fields.Pipeline, fields.Job}
+	case "resource":
+		if fields.Resource == "" {
+			return noGroup, nil
+		}
+		parts = []string{fields.Team, fields.Pipeline, fields.Resource}
+	default:
+		return "", fmt.Errorf("cannot group by '%s'", by)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+func printGroupTable(writer io.Writer, by string, groups []Group) error {
+	data := []ui.TableRow{}
+	for _, group := range groups {
+		data = append(data, ui.TableRow{
+			ui.TableCell{Contents: group.Key},
+			ui.TableCell{Contents: strconv.Itoa(group.Containers)},
+			ui.TableCell{Contents: humanReadable(group.TotalMemory)},
+			ui.TableCell{Contents: humanReadable(group.MaxMemory)},
+			ui.TableCell{Contents: group.OldestAge.String()},
+		})
+	}
+	table := ui.Table{
+		Headers: ui.TableRow{
+			ui.TableCell{
+				Contents: by,
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "containers",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "total memory",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "max memory",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "oldest",
+				Color:    color.New(color.Bold),
+			},
+		},
+		Data: data,
+	}
+	return table.Render(writer, true)
+}
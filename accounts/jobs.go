@@ -0,0 +1,225 @@
+package accounts
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/concourse/concourse/atc/db"
+	"github.com/concourse/concourse/fly/ui"
+	"github.com/fatih/color"
+)
+
+// a BuildPeak is the most memory a build's task containers used at once, in
+// any snapshot it was recorded in.
+type BuildPeak struct {
+	Build  string
+	Memory uint64
+}
+
+// a JobTrend is the peak memory of a job's last builds, oldest first.
+type JobTrend struct {
+	Team     string
+	Pipeline string
+	Job      string
+	Builds   []BuildPeak
+}
+
+func (jt JobTrend) Peak() uint64 {
+	peak := uint64(0)
+	for _, build := range jt.Builds {
+		if build.Memory > peak {
+			peak = build.Memory
+		}
+	}
+	return peak
+}
+
+func (jt JobTrend) Average() uint64 {
+	return averagePeak(jt.Builds)
+}
+
+// Growth is how much more memory the latest build used than the ones before
+// it did on average, as a fraction. It is 0 for jobs with fewer than two
+// builds.
+func (jt JobTrend) Growth() float64 {
+	if len(jt.Builds) < 2 {
+		return 0
+	}
+	earlier := averagePeak(jt.Builds[:len(jt.Builds)-1])
+	if earlier == 0 {
+		return 0
+	}
+	latest := jt.Builds[len(jt.Builds)-1].Memory
+	return (float64(latest) - float64(earlier)) / float64(earlier)
+}
+
+func averagePeak(builds []BuildPeak) uint64 {
+	if len(builds) == 0 {
+		return 0
+	}
+	total := uint64(0)
+	for _, build := range builds {
+		total += build.Memory
+	}
+	return total / uint64(len(builds))
+}
+
+type jobKey struct {
+	team, pipeline, job string
+}
+
+// JobTrends works out, from recorded snapshots, the peak memory of the last
+// builds of each job whose task containers were recorded. A build's peak is
+// the most its task containers used together in a single snapshot, so tasks
+// running in parallel add up. Jobs are listed by their latest growth, most
+// first.
+func JobTrends(snapshots []Snapshot, builds int, filter WorkloadFilter) []JobTrend {
+	peaks := map[jobKey]map[string]uint64{}
+	for _, snapshot := range snapshots {
+		totals := map[jobKey]map[string]uint64{}
+		for _, sample := range snapshot.Samples {
+			if sample.Type != string(db.ContainerTypeTask) {
+				continue
+			}
+			for _, fields := range sample.Workloads {
+				if fields.Job == "" || !filter.matches(fields) {
+					continue
+				}
+				key := jobKey{fields.Team, fields.Pipeline, fields.Job}
+				if totals[key] == nil {
+					totals[key] = map[string]uint64{}
+				}
+				totals[key][fields.Build] += sample.MemoryBytes
+			}
+		}
+		for key, buildTotals := range totals {
+			if peaks[key] == nil {
+				peaks[key] = map[string]uint64{}
+			}
+			for build, total := range buildTotals {
+				if total > peaks[key][build] {
+					peaks[key][build] = total
+				}
+			}
+		}
+	}
+
+	trends := []JobTrend{}
+	for key, buildPeaks := range peaks {
+		trend := JobTrend{Team: key.team, Pipeline: key.pipeline, Job: key.job}
+		for build, memory := range buildPeaks {
+			trend.Builds = append(trend.Builds, BuildPeak{Build: build, Memory: memory})
+		}
+		sort.Slice(trend.Builds, func(i, j int) bool {
+			return buildNameLess(trend.Builds[i].Build, trend.Builds[j].Build)
+		})
+		if builds > 0 && len(trend.Builds) > builds {
+			trend.Builds = trend.Builds[len(trend.Builds)-builds:]
+		}
+		trends = append(trends, trend)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Growth() != trends[j].Growth() {
+			return trends[i].Growth() > trends[j].Growth()
+		}
+		return jobTrendName(trends[i]) < jobTrendName(trends[j])
+	})
+	return trends
+}
+
+// buildNameLess orders build names the way concourse numbers them, i.e. 9
+// before 10, and a rerun like 10.1 after the build it reruns.
+func buildNameLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr != nil || bErr != nil {
+			if as[i] != bs[i] {
+				return as[i] < bs[i]
+			}
+			continue
+		}
+		if an != bn {
+			return an < bn
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func jobTrendName(trend JobTrend) string {
+	return strings.Join([]string{trend.Team, trend.Pipeline, trend.Job}, "/")
+}
+
+func printJobTrendTable(writer io.Writer, trends []JobTrend) error {
+	data := []ui.TableRow{}
+	for _, trend := range trends {
+		growth := ui.TableCell{}
+		if len(trend.Builds) > 1 {
+			growth.Contents = fmt.Sprintf("%+.0f%%", trend.Growth()*100)
+			if trend.Growth() > 0 {
+				growth.Color = color.New(color.FgRed)
+			}
+		}
+		data = append(data, ui.TableRow{
+			ui.TableCell{Contents: jobTrendName(trend)},
+			ui.TableCell{Contents: strconv.Itoa(len(trend.Builds))},
+			ui.TableCell{Contents: humanReadable(trend.Average())},
+			ui.TableCell{Contents: humanReadable(trend.Peak())},
+			ui.TableCell{Contents: humanReadable(trend.Builds[len(trend.Builds)-1].Memory)},
+			growth,
+		})
+	}
+	table := ui.Table{
+		Headers: ui.TableRow{
+			ui.TableCell{
+				Contents: "job",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "builds",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "average",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "peak",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "latest",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "growth",
+				Color:    color.New(color.Bold),
+			},
+		},
+		Data: data,
+	}
+	return table.Render(writer, true)
+}
+
+func jobs(stdout io.Writer, cmd Command) int {
+	store := &SnapshotStore{Path: cmd.SnapshotPath}
+	snapshots, err := store.Between(time.Time{}, time.Now())
+	if err != nil {
+		fmt.Fprintf(stdout, "snapshot error: %s\n", err.Error())
+		return 1
+	}
+	trends := JobTrends(snapshots, cmd.Builds, WorkloadFilter{
+		Teams:     cmd.Teams,
+		Pipelines: cmd.Pipelines,
+	})
+	err = printJobTrendTable(stdout, trends)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+package accounts_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/concourse/concourse/atc/db"
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type JobsSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func taskSample(pipeline, job, build string, memory uint64) accounts.Sample {
+	return accounts.Sample{
+		Container: accounts.Container{
+			Handle: pipeline + job + build,
+			Stats:  accounts.Stats{Memory: memory},
+		},
+		Labels: accounts.Labels{
+			Type: db.ContainerTypeTask,
+			Workloads: []accounts.Workload{
+				testWorkload{accounts.WorkloadFields{
+					Team:     "main",
+					Pipeline: pipeline,
+					Job:      job,
+					Build:    build,
+					Step:     "task",
+				}},
+			},
+		},
+	}
+}
+
+func (s *JobsSuite) TestTakesEachBuildsPeakAcrossSnapshots() {
+	now := time.Now()
+	trends := accounts.JobTrends([]accounts.Snapshot{
+		accounts.NewSnapshot(now, []accounts.Sample{
+			taskSample("p", "j", "1", 100),
+			taskSample("p", "j", "1", 100),
+		}),
+		accounts.NewSnapshot(now.Add(time.Minute), []accounts.Sample{
+			taskSample("p", "j", "1", 150),
+			taskSample("p", "j", "2", 300),
+		}),
+	}, 10, accounts.WorkloadFilter{})
+
+	s.Len(trends, 1)
+	s.Equal([]accounts.BuildPeak{
+		{Build: "1", Memory: 200},
+		{Build: "2", Memory: 300},
+	}, trends[0].Builds)
+	s.Equal(uint64(300), trends[0].Peak())
+	s.Equal(uint64(250), trends[0].Average())
+	s.Equal(0.5, trends[0].Growth())
+}
+
+func (s *JobsSuite) TestOnlyLooksAtTheLastBuilds() {
+	samples := []accounts.Sample{}
+	for _, build := range []string{"9", "10", "10.1", "2", "11"} {
+		samples = append(samples, taskSample("p", "j", build, 100))
+	}
+
+	trends := accounts.JobTrends(
+		[]accounts.Snapshot{accounts.NewSnapshot(time.Now(), samples)},
+		3,
+		accounts.WorkloadFilter{},
+	)
+
+	s.Len(trends, 1)
+	builds := []string{}
+	for _, build := range trends[0].Builds {
+		builds = append(builds, build.Build)
+	}
+	s.Equal([]string{"10", "10.1", "11"}, builds)
+}
+
+func (s *JobsSuite) TestLeavesOutOtherPipelinesAndContainerTypes() {
+	check := taskSample("p", "j", "1", 100)
+	check.Labels.Type = db.ContainerTypeCheck
+
+	trends := accounts.JobTrends(
+		[]accounts.Snapshot{accounts.NewSnapshot(time.Now(), []accounts.Sample{
+			taskSample("p/branch:main", "j", "1", 100),
+			taskSample("q", "j", "1", 100),
+			check,
+		})},
+		10,
+		accounts.WorkloadFilter{Pipelines: []string{"p"}},
+	)
+
+	s.Len(trends, 1)
+	s.Equal("p/branch:main", trends[0].Pipeline)
+}
+
+func (s *JobsSuite) TestReportsJobsFromRecordedSnapshots() {
+	dir, err := ioutil.TempDir("", "ft-snapshots")
+	s.NoError(err)
+	defer os.RemoveAll(dir)
+	store := &accounts.SnapshotStore{Path: filepath.Join(dir, "snapshots.db")}
+	now := time.Now()
+	s.NoError(store.Append(accounts.NewSnapshot(now.Add(-time.Hour), []accounts.Sample{
+		taskSample("p", "creeping", "1", 1024*1024),
+		taskSample("p", "steady", "1", 1024*1024),
+	})))
+	s.NoError(store.Append(accounts.NewSnapshot(now.Add(-time.Minute), []accounts.Sample{
+		taskSample("p", "creeping", "2", 2*1024*1024),
+		taskSample("p", "steady", "2", 1024*1024),
+	})))
+	buf := bytes.NewBuffer([]byte{})
+
+	returnCode := accounts.Execute(
+		nil,
+		nil,
+		noopValidator,
+		[]string{"jobs", "--in", store.Path, "--team", "main"},
+		buf,
+	)
+
+	s.Equal(0, returnCode)
+	s.Regexp(`main/p/creeping\s+2\s+1.5 MB\s+2.0 MB\s+2.0 MB\s+\+100%`, buf.String())
+	s.Regexp(`main/p/steady\s+2\s+1024.0 KB\s+1024.0 KB\s+1024.0 KB\s+\+0%`, buf.String())
+	s.Less(
+		bytes.Index(buf.Bytes(), []byte("creeping")),
+		bytes.Index(buf.Bytes(), []byte("steady")),
+	)
+}
+
+func (s *JobsSuite) TestBuildsMustBePositive() {
+	err := accounts.DefaultValidator(accounts.Command{Subcommand: "jobs"})
+
+	s.EqualError(err, "--builds must be positive")
+}
@@ -93,7 +93,7 @@ func (s *K8sClientSuite) TestGetPodFindsPod() {
 	s.Equal(host, "example.com")
 }
 
-func (s *K8sClientSuite) TestGetSecretLooksUpSecrets() {
+func (s *K8sClientSuite) TestGetSecretDataLooksUpSecrets() {
 	namespace := "namespace"
 	secretName := "secret-name"
 	fakeAPI := s.fakeAPI(
@@ -115,7 +115,65 @@ func (s *K8sClientSuite) TestGetSecretLooksUpSecrets() {
 		},
 	}
 	client := accounts.NewK8sClient(restConfig, namespace)
-	val, err := client.GetSecret(secretName, "postgresql-user")
+	data, err := client.GetSecretData(secretName)
 	s.NoError(err)
-	s.Equal(val, "user")
+	s.Equal(map[string]string{"postgresql-user": "user"}, data)
+}
+
+func (s *K8sClientSuite) TestGetConfigMapDataLooksUpConfigMaps() {
+	namespace := "namespace"
+	configMapName := "web-config"
+	fakeAPI := s.fakeAPI(
+		"/api/v1/namespaces/"+namespace+"/configmaps/"+configMapName,
+		&corev1.ConfigMap{
+			Data: map[string]string{
+				"postgres-host": "db.example.com",
+			},
+		},
+	)
+	defer fakeAPI.Close()
+	restConfig := &restclient.Config{
+		Host:    fakeAPI.URL,
+		APIPath: "/api",
+		ContentConfig: restclient.ContentConfig{
+			NegotiatedSerializer: scheme.Codecs,
+			ContentType:          runtime.ContentTypeJSON,
+			GroupVersion:         &corev1.SchemeGroupVersion,
+		},
+	}
+	client := accounts.NewK8sClient(restConfig, namespace)
+	data, err := client.GetConfigMapData(configMapName)
+	s.NoError(err)
+	s.Equal(map[string]string{"postgres-host": "db.example.com"}, data)
+}
+
+func (s *K8sClientSuite) TestListPodsFindsPods() {
+	namespace := "namespace"
+	fakeAPI := s.fakeAPI(
+		"/api/v1/namespaces/"+namespace+"/pods",
+		&corev1.PodList{
+			Items: []corev1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}},
+			},
+		},
+	)
+	defer fakeAPI.Close()
+	restConfig := &restclient.Config{
+		Host:    fakeAPI.URL,
+		APIPath: "/api",
+		ContentConfig: restclient.ContentConfig{
+			NegotiatedSerializer: scheme.Codecs,
+			ContentType:          runtime.ContentTypeJSON,
+			GroupVersion:         &corev1.SchemeGroupVersion,
+		},
+	}
+	client := accounts.NewK8sClient(restConfig, namespace)
+
+	pods, err := client.ListPods("app=concourse-worker")
+
+	s.NoError(err)
+	s.Len(pods, 2)
+	s.Equal("worker-0", pods[0].Name)
+	s.Equal("worker-1", pods[1].Name)
 }
@@ -0,0 +1,199 @@
+package accounts
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/rest"
+)
+
+// a K8sPort is a port of a pod, to be port-forwarded to.
+type K8sPort struct {
+	Namespace string
+	Pod       string
+	Port      string
+}
+
+// a K8sPostgresDialer reaches a postgres that web pods know by a name only
+// resolvable inside the cluster, i.e. a service, by port-forwarding to a pod
+// behind it. Hosts which aren't names in the cluster are dialed directly.
+type K8sPostgresDialer struct {
+	RESTConfig *rest.Config
+	// Namespace is where services named without one are, the web pod's.
+	Namespace string
+	// Clients gives a client for each namespace the names point into,
+	// NewK8sClient if unset.
+	Clients func(namespace string) K8sClient
+}
+
+func (kpd *K8sPostgresDialer) Dial(network, address string) (net.Conn, error) {
+	port, err := kpd.ForwardedPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if port == nil {
+		return net.Dial(network, address)
+	}
+	dialer := &K8sGardenDialer{
+		RESTConfig: kpd.RESTConfig,
+		Namespace:  port.Namespace,
+		PodName:    port.Pod,
+	}
+	return dialer.DialPort(port.Port)
+}
+
+func (kpd *K8sPostgresDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	type dialed struct {
+		conn net.Conn
+		err  error
+	}
+	result := make(chan dialed, 1)
+	go func() {
+		conn, err := kpd.Dial(network, address)
+		result <- dialed{conn, err}
+	}()
+	select {
+	case d := <-result:
+		return d.conn, d.err
+	case <-time.After(timeout):
+		// close the connection if it is made after all
+		go func() {
+			if d := <-result; d.conn != nil {
+				d.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out dialing %s after %s", address, timeout)
+	}
+}
+
+// ForwardedPort finds the pod and port an address in the cluster is served
+// from. It is nil for addresses outside the cluster.
+//
+// Addresses are cluster DNS names: service, service.namespace or
+// service.namespace.svc.<cluster domain>, or pod.service.namespace.svc... for
+// the pods of a statefulset.
+func (kpd *K8sPostgresDialer) ForwardedPort(address string) (*K8sPort, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return nil, nil
+	}
+	names := strings.Split(strings.TrimSuffix(host, "."), ".")
+	qualified := false
+	for i, name := range names {
+		if name == "svc" {
+			names = names[:i]
+			qualified = true
+			break
+		}
+	}
+	namespace := kpd.Namespace
+	switch {
+	case len(names) == 3 && qualified:
+		namespace = names[2]
+		client := kpd.client(namespace)
+		pod, err := client.GetPod(names[0])
+		if err != nil {
+			return nil, err
+		}
+		return &K8sPort{Namespace: namespace, Pod: pod.Name, Port: port}, nil
+	case len(names) == 2:
+		namespace = names[1]
+	case len(names) != 1:
+		return nil, nil
+	}
+
+	client := kpd.client(namespace)
+	service, err := client.GetService(names[0])
+	// unqualified names which aren't services, or are in namespaces that
+	// can't be looked into, may be resolvable from here
+	if (apierrors.IsNotFound(err) || apierrors.IsForbidden(err)) && !qualified {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// services without a selector, i.e. ones with endpoints managed by hand
+	// for a database outside the cluster, have no pods to forward to
+	if service.Spec.Type == corev1.ServiceTypeExternalName || len(service.Spec.Selector) == 0 {
+		return nil, nil
+	}
+	target, err := targetPort(service, port)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.ListPods(labels.SelectorFromSet(service.Spec.Selector).String())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	for _, pod := range pods {
+		if !podReady(pod) {
+			continue
+		}
+		podPort, err := containerPort(pod, target)
+		if err != nil {
+			return nil, err
+		}
+		return &K8sPort{Namespace: namespace, Pod: pod.Name, Port: podPort}, nil
+	}
+	return nil, fmt.Errorf("service '%s' has no ready pods", service.Name)
+}
+
+func (kpd *K8sPostgresDialer) client(namespace string) K8sClient {
+	if kpd.Clients != nil {
+		return kpd.Clients(namespace)
+	}
+	return NewK8sClient(kpd.RESTConfig, namespace)
+}
+
+// targetPort finds the port of the pods a port of a service goes to.
+func targetPort(service *corev1.Service, port string) (intstr.IntOrString, error) {
+	for _, servicePort := range service.Spec.Ports {
+		if strconv.Itoa(int(servicePort.Port)) != port {
+			continue
+		}
+		target := servicePort.TargetPort
+		if target.Type == intstr.Int && target.IntVal == 0 {
+			return intstr.FromInt(int(servicePort.Port)), nil
+		}
+		return target, nil
+	}
+	return intstr.IntOrString{}, fmt.Errorf(
+		"service '%s' has no port %s",
+		service.Name,
+		port,
+	)
+}
+
+// containerPort finds the number of a target port, which may be the name of
+// one of a pod's container ports.
+func containerPort(pod corev1.Pod, target intstr.IntOrString) (string, error) {
+	if target.Type == intstr.Int {
+		return strconv.Itoa(int(target.IntVal)), nil
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == target.StrVal {
+				return strconv.Itoa(int(port.ContainerPort)), nil
+			}
+		}
+	}
+	return "", fmt.Errorf(
+		"pod '%s' has no port named '%s'",
+		pod.Name,
+		target.StrVal,
+	)
+}
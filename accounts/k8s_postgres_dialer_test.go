@@ -0,0 +1,195 @@
+package accounts_test
+
+import (
+	"errors"
+
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type K8sPostgresDialerSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func postgresPod(name string, ready bool) corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"app": "postgresql"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "postgresql",
+					Ports: []corev1.ContainerPort{
+						{
+							Name:          "tcp-postgresql",
+							ContainerPort: 5432,
+						},
+					},
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			Conditions: []corev1.PodCondition{
+				{
+					Type:   corev1.PodReady,
+					Status: status,
+				},
+			},
+		},
+	}
+}
+
+func (s *K8sPostgresDialerSuite) dialer(client *testk8sClient) (*accounts.K8sPostgresDialer, *[]string) {
+	namespaces := []string{}
+	return &accounts.K8sPostgresDialer{
+		Namespace: "ci",
+		Clients: func(namespace string) accounts.K8sClient {
+			namespaces = append(namespaces, namespace)
+			return client
+		},
+	}, &namespaces
+}
+
+func (s *K8sPostgresDialerSuite) TestForwardsServiceToReadyPod() {
+	dialer, namespaces := s.dialer(&testk8sClient{
+		services: map[string]*corev1.Service{
+			"ci-postgresql": &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "ci-postgresql"},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "postgresql"},
+					Ports: []corev1.ServicePort{
+						{
+							Port:       5432,
+							TargetPort: intstr.FromString("tcp-postgresql"),
+						},
+					},
+				},
+			},
+		},
+		pods: []corev1.Pod{
+			postgresPod("ci-postgresql-1", true),
+			postgresPod("ci-postgresql-0", false),
+		},
+	})
+
+	port, err := dialer.ForwardedPort("ci-postgresql:5432")
+	s.NoError(err)
+	s.Equal(&accounts.K8sPort{Namespace: "ci", Pod: "ci-postgresql-1", Port: "5432"}, port)
+
+	port, err = dialer.ForwardedPort("ci-postgresql.db.svc.cluster.local:5432")
+	s.NoError(err)
+	s.Equal(&accounts.K8sPort{Namespace: "db", Pod: "ci-postgresql-1", Port: "5432"}, port)
+	s.Equal([]string{"ci", "db"}, *namespaces)
+
+	_, err = dialer.ForwardedPort("ci-postgresql:5433")
+	s.EqualError(err, "service 'ci-postgresql' has no port 5433")
+}
+
+func (s *K8sPostgresDialerSuite) TestForwardsStatefulSetPod() {
+	dialer, namespaces := s.dialer(&testk8sClient{
+		pods: []corev1.Pod{
+			postgresPod("ci-postgresql-0", true),
+		},
+	})
+
+	port, err := dialer.ForwardedPort("ci-postgresql-0.ci-postgresql-headless.db.svc:5432")
+	s.NoError(err)
+	s.Equal(&accounts.K8sPort{Namespace: "db", Pod: "ci-postgresql-0", Port: "5432"}, port)
+	s.Equal([]string{"db"}, *namespaces)
+}
+
+func (s *K8sPostgresDialerSuite) TestDialsAddressesOutsideClusterDirectly() {
+	dialer, _ := s.dialer(&testk8sClient{})
+
+	for _, address := range []string{
+		"10.0.0.5:5432",
+		"db.example.com:5432",
+		"postgres:5432",
+	} {
+		port, err := dialer.ForwardedPort(address)
+		s.NoError(err)
+		s.Nil(port, address)
+	}
+}
+
+func (s *K8sPostgresDialerSuite) TestDialsServicesWithoutSelectorsDirectly() {
+	dialer, _ := s.dialer(&testk8sClient{
+		services: map[string]*corev1.Service{
+			"external-postgresql": &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "external-postgresql"},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{{Port: 5432}},
+				},
+			},
+		},
+	})
+
+	port, err := dialer.ForwardedPort("external-postgresql.ci.svc.cluster.local:5432")
+
+	s.NoError(err)
+	s.Nil(port)
+}
+
+// a forbiddenServicesClient isn't allowed to look up services, as in
+// namespaces without RBAC for them.
+type forbiddenServicesClient struct {
+	*testk8sClient
+}
+
+func (fsc forbiddenServicesClient) GetService(name string) (*corev1.Service, error) {
+	return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "services"}, name, errors.New("no access"))
+}
+
+func (s *K8sPostgresDialerSuite) TestDialsUnqualifiedNamesDirectlyWhenServicesAreForbidden() {
+	dialer := &accounts.K8sPostgresDialer{
+		Namespace: "ci",
+		Clients: func(string) accounts.K8sClient {
+			return forbiddenServicesClient{&testk8sClient{}}
+		},
+	}
+
+	port, err := dialer.ForwardedPort("postgres.example:5432")
+	s.NoError(err)
+	s.Nil(port)
+
+	_, err = dialer.ForwardedPort("ci-postgresql.db.svc.cluster.local:5432")
+	s.True(apierrors.IsForbidden(err))
+}
+
+func (s *K8sPostgresDialerSuite) TestFailsWithoutReadyPods() {
+	dialer, _ := s.dialer(&testk8sClient{
+		services: map[string]*corev1.Service{
+			"ci-postgresql": &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "ci-postgresql"},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "postgresql"},
+					Ports: []corev1.ServicePort{
+						{
+							Port: 5432,
+						},
+					},
+				},
+			},
+		},
+		pods: []corev1.Pod{
+			postgresPod("ci-postgresql-0", false),
+		},
+	})
+
+	_, err := dialer.ForwardedPort("ci-postgresql:5432")
+	s.EqualError(err, "service 'ci-postgresql' has no ready pods")
+}
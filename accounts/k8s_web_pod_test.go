@@ -4,7 +4,11 @@ import (
 	"github.com/concourse/ft/accounts"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type K8sWebPodSuite struct {
@@ -13,15 +17,95 @@ type K8sWebPodSuite struct {
 }
 
 type testk8sClient struct {
-	secrets map[string]map[string]string
+	secrets      map[string]map[string]string
+	configMaps   map[string]map[string]string
+	pods         []corev1.Pod
+	deployments  []appsv1.Deployment
+	statefulSets []appsv1.StatefulSet
+	services     map[string]*corev1.Service
 }
 
 func (tkc *testk8sClient) GetPod(name string) (*corev1.Pod, error) {
-	return nil, nil
+	for i := range tkc.pods {
+		if tkc.pods[i].Name == name {
+			return &tkc.pods[i], nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, name)
+}
+
+func (tkc *testk8sClient) GetService(name string) (*corev1.Service, error) {
+	service, ok := tkc.services[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, name)
+	}
+	return service, nil
+}
+
+func (tkc *testk8sClient) GetSecretData(name string) (map[string]string, error) {
+	data, ok := tkc.secrets[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+	}
+	return data, nil
+}
+
+func (tkc *testk8sClient) GetConfigMapData(name string) (map[string]string, error) {
+	data, ok := tkc.configMaps[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return data, nil
+}
+
+func (tkc *testk8sClient) GetDeployment(name string) (*appsv1.Deployment, error) {
+	for i := range tkc.deployments {
+		if tkc.deployments[i].Name == name {
+			return &tkc.deployments[i], nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "deployments"}, name)
+}
+
+func (tkc *testk8sClient) GetStatefulSet(name string) (*appsv1.StatefulSet, error) {
+	for i := range tkc.statefulSets {
+		if tkc.statefulSets[i].Name == name {
+			return &tkc.statefulSets[i], nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "statefulsets"}, name)
+}
+
+func (tkc *testk8sClient) ListDeployments(selector string) ([]appsv1.Deployment, error) {
+	matches, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	deployments := []appsv1.Deployment{}
+	for _, deployment := range tkc.deployments {
+		if matches.Matches(labels.Set(deployment.Labels)) {
+			deployments = append(deployments, deployment)
+		}
+	}
+	return deployments, nil
 }
 
-func (tkc *testk8sClient) GetSecret(name, key string) (string, error) {
-	return tkc.secrets[name][key], nil
+func (tkc *testk8sClient) ListStatefulSets(selector string) ([]appsv1.StatefulSet, error) {
+	matches, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	statefulSets := []appsv1.StatefulSet{}
+	for _, statefulSet := range tkc.statefulSets {
+		if matches.Matches(labels.Set(statefulSet.Labels)) {
+			statefulSets = append(statefulSets, statefulSet)
+		}
+	}
+	return statefulSets, nil
+}
+
+func (tkc *testk8sClient) ListPods(selector string) ([]corev1.Pod, error) {
+	return tkc.pods, nil
 }
 
 func (s *K8sWebPodSuite) TestValueFromEnvVarLooksUpSecret() {
@@ -126,6 +210,57 @@ func (s *K8sWebPodSuite) TestFileContentsFromEnvVarGetsCertFromSecret() {
 	s.Equal(fileContents, "ssl cert")
 }
 
+func (s *K8sWebPodSuite) TestFileContentsFromEnvVarFailsWithoutMatchingItem() {
+	container := corev1.Container{
+		Name: "helm-release-web",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "CONCOURSE_POSTGRES_CA_CERT",
+				Value: "/postgres-keys/ca.cert",
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "keys-volume",
+				MountPath: "/postgres-keys",
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+				Volumes: []corev1.Volume{
+					{
+						Name: "keys-volume",
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{
+								SecretName: "secret-name",
+								Items: []corev1.KeyToPath{
+									{
+										Key:  "postgresql-client-cert",
+										Path: "client.cert",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Client: &testk8sClient{
+			secrets: map[string]map[string]string{
+				"secret-name": map[string]string{
+					"postgresql-client-cert": "client cert",
+				},
+			},
+		},
+	}
+
+	_, err := pod.FileContentsFromEnvVar("CONCOURSE_POSTGRES_CA_CERT")
+	s.EqualError(err, "volume 'keys-volume' has no item at 'ca.cert'")
+}
+
 func (s *K8sWebPodSuite) TestValueFromEnvVarFailsWithNoContainers() {
 	pod := &accounts.K8sWebPod{
 		Pod: &corev1.Pod{
@@ -327,3 +462,369 @@ func (s *K8sWebPodSuite) TestPostgresParamNamesReturnsEnvVarsWithPrefix() {
 	paramNames, _ := pod.PostgresParamNames()
 	s.Equal([]string{"CONCOURSE_POSTGRES_CA_CERT"}, paramNames)
 }
+
+func (s *K8sWebPodSuite) TestValueFromEnvVarLooksUpConfigMap() {
+	container := corev1.Container{
+		Name: "helm-release-web",
+		Env: []corev1.EnvVar{
+			{
+				Name: "CONCOURSE_POSTGRES_HOST",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "web-config",
+						},
+						Key: "postgres-host",
+					},
+				},
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+			},
+		},
+		Client: &testk8sClient{
+			configMaps: map[string]map[string]string{
+				"web-config": map[string]string{
+					"postgres-host": "db.example.com",
+				},
+			},
+		},
+	}
+
+	host, err := pod.ValueFromEnvVar("CONCOURSE_POSTGRES_HOST")
+	s.NoError(err)
+	s.Equal("db.example.com", host)
+}
+
+func (s *K8sWebPodSuite) TestValueFromEnvVarFailsWithMissingConfigMapKey() {
+	container := corev1.Container{
+		Name: "helm-release-web",
+		Env: []corev1.EnvVar{
+			{
+				Name: "CONCOURSE_POSTGRES_HOST",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "web-config",
+						},
+						Key: "postgres-host",
+					},
+				},
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+			},
+		},
+		Client: &testk8sClient{
+			configMaps: map[string]map[string]string{
+				"web-config": map[string]string{},
+			},
+		},
+	}
+
+	_, err := pod.ValueFromEnvVar("CONCOURSE_POSTGRES_HOST")
+	s.EqualError(err, "config map 'web-config' has no key 'postgres-host'")
+}
+
+func (s *K8sWebPodSuite) TestValueFromEnvVarLooksUpEnvFrom() {
+	optional := true
+	container := corev1.Container{
+		Name: "helm-release-web",
+		EnvFrom: []corev1.EnvFromSource{
+			{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "web-config",
+					},
+				},
+			},
+			{
+				Prefix: "CONCOURSE_POSTGRES_",
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "postgres",
+					},
+				},
+			},
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "missing",
+					},
+					Optional: &optional,
+				},
+			},
+		},
+		Env: []corev1.EnvVar{
+			{
+				Name:  "CONCOURSE_POSTGRES_PORT",
+				Value: "6543",
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+			},
+		},
+		Client: &testk8sClient{
+			secrets: map[string]map[string]string{
+				"postgres": map[string]string{
+					"USER":     "username",
+					"PASSWORD": "password",
+					"PORT":     "5432",
+				},
+			},
+			configMaps: map[string]map[string]string{
+				"web-config": map[string]string{
+					"CONCOURSE_POSTGRES_USER":     "overridden",
+					"CONCOURSE_POSTGRES_DATABASE": "atc",
+					"CONCOURSE_EXTERNAL_URL":      "https://ci.example.com",
+				},
+			},
+		},
+	}
+
+	paramNames, err := pod.PostgresParamNames()
+	s.NoError(err)
+	s.Equal(
+		[]string{
+			"CONCOURSE_POSTGRES_PORT",
+			"CONCOURSE_POSTGRES_DATABASE",
+			"CONCOURSE_POSTGRES_USER",
+			"CONCOURSE_POSTGRES_PASSWORD",
+		},
+		paramNames,
+	)
+	for param, expected := range map[string]string{
+		"CONCOURSE_POSTGRES_USER":     "username",
+		"CONCOURSE_POSTGRES_DATABASE": "atc",
+		"CONCOURSE_POSTGRES_PORT":     "6543",
+	} {
+		value, err := pod.ValueFromEnvVar(param)
+		s.NoError(err)
+		s.Equal(expected, value, param)
+	}
+}
+
+func (s *K8sWebPodSuite) TestValueFromEnvVarExpandsReferences() {
+	container := corev1.Container{
+		Name: "helm-release-web",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "RELEASE",
+				Value: "helm-release",
+			},
+			{
+				Name:  "CONCOURSE_POSTGRES_HOST",
+				Value: "$(RELEASE)-postgresql.$(NAMESPACE).svc",
+			},
+			{
+				Name:  "CONCOURSE_POSTGRES_PASSWORD",
+				Value: "pa$$word",
+			},
+			{
+				Name:  "NAMESPACE",
+				Value: "ci",
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+			},
+		},
+	}
+
+	host, err := pod.ValueFromEnvVar("CONCOURSE_POSTGRES_HOST")
+	s.NoError(err)
+	// like the kubelet, only variables defined before are expanded
+	s.Equal("helm-release-postgresql.$(NAMESPACE).svc", host)
+
+	password, err := pod.ValueFromEnvVar("CONCOURSE_POSTGRES_PASSWORD")
+	s.NoError(err)
+	s.Equal("pa$word", password)
+}
+
+func (s *K8sWebPodSuite) TestFileContentsFromEnvVarGetsCertFromProjectedVolume() {
+	container := corev1.Container{
+		Name: "helm-release-web",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "CONCOURSE_POSTGRES_CA_CERT",
+				Value: "/postgres-keys/ca.cert",
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "keys-volume",
+				MountPath: "/postgres-keys",
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+				Volumes: []corev1.Volume{
+					{
+						Name: "keys-volume",
+						VolumeSource: corev1.VolumeSource{
+							Projected: &corev1.ProjectedVolumeSource{
+								Sources: []corev1.VolumeProjection{
+									{
+										ConfigMap: &corev1.ConfigMapProjection{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "web-config",
+											},
+											Items: []corev1.KeyToPath{
+												{
+													Key:  "external-url",
+													Path: "url",
+												},
+											},
+										},
+									},
+									{
+										Secret: &corev1.SecretProjection{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: "postgres",
+											},
+											Items: []corev1.KeyToPath{
+												{
+													Key:  "postgresql-ca-cert",
+													Path: "ca.cert",
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Client: &testk8sClient{
+			secrets: map[string]map[string]string{
+				"postgres": map[string]string{
+					"postgresql-ca-cert": "some-cert",
+				},
+			},
+		},
+	}
+
+	cert, err := pod.FileContentsFromEnvVar("CONCOURSE_POSTGRES_CA_CERT")
+	s.NoError(err)
+	s.Equal("some-cert", cert)
+}
+
+func (s *K8sWebPodSuite) TestValueFromEnvVarFailsWithFieldRef() {
+	container := corev1.Container{
+		Name: "helm-release-web",
+		Env: []corev1.EnvVar{
+			{
+				Name: "CONCOURSE_POSTGRES_HOST",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "status.hostIP",
+					},
+				},
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+			},
+		},
+	}
+
+	_, err := pod.ValueFromEnvVar("CONCOURSE_POSTGRES_HOST")
+	s.Equal(
+		accounts.UnsupportedSourceError{
+			Param:  "CONCOURSE_POSTGRES_HOST",
+			Source: "the pod's field 'status.hostIP'",
+		},
+		err,
+	)
+}
+
+func (s *K8sWebPodSuite) TestFileContentsFromEnvVarFailsWithEmptyDir() {
+	container := corev1.Container{
+		Name: "helm-release-web",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "CONCOURSE_POSTGRES_CA_CERT",
+				Value: "/postgres-keys/ca.cert",
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "keys-volume",
+				MountPath: "/postgres-keys",
+			},
+		},
+	}
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container},
+				Volumes: []corev1.Volume{
+					{
+						Name: "keys-volume",
+						VolumeSource: corev1.VolumeSource{
+							EmptyDir: &corev1.EmptyDirVolumeSource{},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := pod.FileContentsFromEnvVar("CONCOURSE_POSTGRES_CA_CERT")
+	s.IsType(accounts.UnsupportedSourceError{}, err)
+}
+
+func (s *K8sWebPodSuite) TestValueFromEnvVarUsesNamedContainer() {
+	pod := &accounts.K8sWebPod{
+		Pod: &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "web-proxy",
+					},
+					{
+						Name: "concourse",
+						Env: []corev1.EnvVar{
+							{
+								Name:  "CONCOURSE_POSTGRES_HOST",
+								Value: "db.example.com",
+							},
+						},
+					},
+				},
+			},
+		},
+		Container: "concourse",
+	}
+
+	host, err := pod.ValueFromEnvVar("CONCOURSE_POSTGRES_HOST")
+	s.NoError(err)
+	s.Equal("db.example.com", host)
+
+	pod.Container = "atc"
+	_, err = pod.ValueFromEnvVar("CONCOURSE_POSTGRES_HOST")
+	s.EqualError(err, "could not find a container named 'atc'")
+}
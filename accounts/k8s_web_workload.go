@@ -0,0 +1,210 @@
+package accounts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// a K8sWebWorkload is the Deployment or StatefulSet the web pods are run by,
+// from which a web pod is found without knowing its ever-changing name.
+type K8sWebWorkload struct {
+	Kind string
+	Name string
+}
+
+// ParseK8sWebWorkload reads a workload the way kubectl names one, i.e.
+// statefulset/web, defaulting to a Deployment when no kind is given.
+func ParseK8sWebWorkload(s string) (K8sWebWorkload, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) == 1 {
+		return K8sWebWorkload{Kind: "deployment", Name: s}, nil
+	}
+	kind := strings.ToLower(parts[0])
+	switch kind {
+	case "deployment", "deployments", "deploy":
+		kind = "deployment"
+	case "statefulset", "statefulsets", "sts":
+		kind = "statefulset"
+	default:
+		return K8sWebWorkload{}, fmt.Errorf(
+			"'%s' is not a deployment or statefulset",
+			s,
+		)
+	}
+	if parts[1] == "" {
+		return K8sWebWorkload{}, fmt.Errorf("'%s' has no name", s)
+	}
+	return K8sWebWorkload{Kind: kind, Name: parts[1]}, nil
+}
+
+func (kww K8sWebWorkload) String() string {
+	return kww.Kind + "/" + kww.Name
+}
+
+// a webWorkload is what is needed of a Deployment or StatefulSet to find its
+// pods.
+type webWorkload struct {
+	name     string
+	selector *metav1.LabelSelector
+	template corev1.PodTemplateSpec
+}
+
+// FindWebPod finds the web pod of a Deployment or StatefulSet, or of the
+// one in a helm release that runs a web container. The first ready pod is
+// used; when there is none, a pod is made up from the template, which has the
+// same environment and volumes but no name to be port-forwarded to.
+func FindWebPod(client K8sClient, workload *K8sWebWorkload, helmRelease, container string) (*corev1.Pod, error) {
+	found, pods, err := webWorkloadPods(client, workload, helmRelease, container)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		if podReady(pods[i]) {
+			return &pods[i], nil
+		}
+	}
+	return &corev1.Pod{
+		ObjectMeta: found.template.ObjectMeta,
+		Spec:       found.template.Spec,
+	}, nil
+}
+
+// FindWebPods finds every pod of the workload FindWebPod would, ready or not,
+// sorted by name.
+func FindWebPods(client K8sClient, workload *K8sWebWorkload, helmRelease, container string) ([]corev1.Pod, error) {
+	_, pods, err := webWorkloadPods(client, workload, helmRelease, container)
+	return pods, err
+}
+
+func webWorkloadPods(client K8sClient, workload *K8sWebWorkload, helmRelease, container string) (webWorkload, []corev1.Pod, error) {
+	var (
+		found webWorkload
+		err   error
+	)
+	if workload != nil {
+		found, err = getWebWorkload(client, *workload)
+	} else {
+		found, err = helmReleaseWebWorkload(client, helmRelease, container)
+	}
+	if err != nil {
+		return webWorkload{}, nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(found.selector)
+	if err != nil {
+		return webWorkload{}, nil, err
+	}
+	pods, err := client.ListPods(selector.String())
+	if err != nil {
+		return webWorkload{}, nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return found, pods, nil
+}
+
+func getWebWorkload(client K8sClient, workload K8sWebWorkload) (webWorkload, error) {
+	switch workload.Kind {
+	case "statefulset":
+		statefulSet, err := client.GetStatefulSet(workload.Name)
+		if err != nil {
+			return webWorkload{}, err
+		}
+		return statefulSetWorkload(*statefulSet), nil
+	default:
+		deployment, err := client.GetDeployment(workload.Name)
+		if err != nil {
+			return webWorkload{}, err
+		}
+		return deploymentWorkload(*deployment), nil
+	}
+}
+
+// helmReleaseWebWorkload finds the Deployment or StatefulSet of a helm
+// release whose pods have a web container. Releases are told apart by the
+// recommended app.kubernetes.io/instance label or, as in concourse's chart,
+// by a release label.
+func helmReleaseWebWorkload(client K8sClient, release, container string) (webWorkload, error) {
+	candidates := []webWorkload{}
+	for _, selector := range []string{
+		"app.kubernetes.io/instance=" + release,
+		"release=" + release,
+	} {
+		deployments, err := client.ListDeployments(selector)
+		if err != nil {
+			return webWorkload{}, err
+		}
+		for _, deployment := range deployments {
+			candidates = append(candidates, deploymentWorkload(deployment))
+		}
+		statefulSets, err := client.ListStatefulSets(selector)
+		if err != nil {
+			return webWorkload{}, err
+		}
+		for _, statefulSet := range statefulSets {
+			candidates = append(candidates, statefulSetWorkload(statefulSet))
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+	web := []webWorkload{}
+	for _, candidate := range candidates {
+		if _, err := findWebContainer(candidate.template.Spec, container); err == nil {
+			web = append(web, candidate)
+		}
+	}
+	switch len(web) {
+	case 0:
+		return webWorkload{}, fmt.Errorf(
+			"helm release '%s' has no deployment or statefulset running a web container",
+			release,
+		)
+	case 1:
+		return web[0], nil
+	default:
+		names := []string{}
+		for _, workload := range web {
+			names = append(names, workload.name)
+		}
+		sort.Strings(names)
+		return webWorkload{}, fmt.Errorf(
+			"helm release '%s' runs web containers in more than one workload: %s",
+			release,
+			strings.Join(names, ", "),
+		)
+	}
+}
+
+func deploymentWorkload(deployment appsv1.Deployment) webWorkload {
+	return webWorkload{
+		name:     "deployment/" + deployment.Name,
+		selector: deployment.Spec.Selector,
+		template: deployment.Spec.Template,
+	}
+}
+
+func statefulSetWorkload(statefulSet appsv1.StatefulSet) webWorkload {
+	return webWorkload{
+		name:     "statefulset/" + statefulSet.Name,
+		selector: statefulSet.Spec.Selector,
+		template: statefulSet.Spec.Template,
+	}
+}
+
+func podReady(pod corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package accounts_test
+
+import (
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type K8sWebWorkloadSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func webPodTemplate(host string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app": "concourse-web"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "concourse-web",
+					Env: []corev1.EnvVar{
+						{
+							Name:  "CONCOURSE_POSTGRES_HOST",
+							Value: host,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func webPod(name string, ready bool) corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	template := webPodTemplate("db.example.com")
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: template.Labels,
+		},
+		Spec: template.Spec,
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			Conditions: []corev1.PodCondition{
+				{
+					Type:   corev1.PodReady,
+					Status: status,
+				},
+			},
+		},
+	}
+}
+
+func webDeployment(name string, labels map[string]string) appsv1.Deployment {
+	return appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "concourse-web"},
+			},
+			Template: webPodTemplate("template.example.com"),
+		},
+	}
+}
+
+func (s *K8sWebWorkloadSuite) TestParseK8sWebWorkload() {
+	workload, err := accounts.ParseK8sWebWorkload("concourse-web")
+	s.NoError(err)
+	s.Equal(accounts.K8sWebWorkload{Kind: "deployment", Name: "concourse-web"}, workload)
+
+	workload, err = accounts.ParseK8sWebWorkload("sts/concourse-web")
+	s.NoError(err)
+	s.Equal(accounts.K8sWebWorkload{Kind: "statefulset", Name: "concourse-web"}, workload)
+
+	_, err = accounts.ParseK8sWebWorkload("deployment/")
+	s.EqualError(err, "'deployment/' has no name")
+}
+
+func (s *K8sWebWorkloadSuite) TestFindWebPodFindsReadyPodOfDeployment() {
+	client := &testk8sClient{
+		deployments: []appsv1.Deployment{
+			webDeployment("concourse-web", nil),
+		},
+		pods: []corev1.Pod{
+			webPod("concourse-web-b", true),
+			webPod("concourse-web-a", false),
+		},
+	}
+
+	pod, err := accounts.FindWebPod(
+		client,
+		&accounts.K8sWebWorkload{Kind: "deployment", Name: "concourse-web"},
+		"",
+		"",
+	)
+	s.NoError(err)
+	s.Equal("concourse-web-b", pod.Name)
+}
+
+func (s *K8sWebWorkloadSuite) TestFindWebPodFallsBackToPodTemplate() {
+	client := &testk8sClient{
+		statefulSets: []appsv1.StatefulSet{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "concourse-web"},
+				Spec: appsv1.StatefulSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "concourse-web"},
+					},
+					Template: webPodTemplate("template.example.com"),
+				},
+			},
+		},
+		pods: []corev1.Pod{
+			webPod("concourse-web-0", false),
+		},
+	}
+
+	pod, err := accounts.FindWebPod(
+		client,
+		&accounts.K8sWebWorkload{Kind: "statefulset", Name: "concourse-web"},
+		"",
+		"",
+	)
+	s.NoError(err)
+	s.Equal("", pod.Name)
+
+	host, err := (&accounts.K8sWebPod{Pod: pod, Client: client}).
+		ValueFromEnvVar("CONCOURSE_POSTGRES_HOST")
+	s.NoError(err)
+	s.Equal("template.example.com", host)
+}
+
+func (s *K8sWebWorkloadSuite) TestFindWebPodFindsHelmReleaseWebDeployment() {
+	worker := webDeployment("ci-worker", map[string]string{"release": "ci"})
+	worker.Spec.Template.Spec.Containers[0].Name = "ci-worker"
+	client := &testk8sClient{
+		deployments: []appsv1.Deployment{
+			worker,
+			webDeployment("ci-web", map[string]string{"release": "ci"}),
+			webDeployment("other-web", map[string]string{"release": "other"}),
+		},
+		pods: []corev1.Pod{
+			webPod("ci-web-1234", true),
+		},
+	}
+
+	pod, err := accounts.FindWebPod(client, nil, "ci", "")
+	s.NoError(err)
+	s.Equal("ci-web-1234", pod.Name)
+}
+
+func (s *K8sWebWorkloadSuite) TestFindWebPodFailsWithoutHelmReleaseWebDeployment() {
+	client := &testk8sClient{
+		deployments: []appsv1.Deployment{
+			webDeployment("other-web", map[string]string{"release": "other"}),
+		},
+	}
+
+	_, err := accounts.FindWebPod(client, nil, "ci", "")
+	s.EqualError(err, "helm release 'ci' has no deployment or statefulset running a web container")
+}
+
+func (s *K8sWebWorkloadSuite) TestFindWebPodsFindsEveryPodOfDeployment() {
+	client := &testk8sClient{
+		deployments: []appsv1.Deployment{
+			webDeployment("concourse-web", nil),
+		},
+		pods: []corev1.Pod{
+			webPod("concourse-web-b", true),
+			webPod("concourse-web-a", false),
+		},
+	}
+
+	pods, err := accounts.FindWebPods(
+		client,
+		&accounts.K8sWebWorkload{Kind: "deployment", Name: "concourse-web"},
+		"",
+		"",
+	)
+
+	s.NoError(err)
+	s.Len(pods, 2)
+	s.Equal("concourse-web-a", pods[0].Name)
+	s.Equal("concourse-web-b", pods[1].Name)
+}
+
+func (s *K8sWebWorkloadSuite) TestK8sWebPodDialerPicksThePodWithTheWorkersIP() {
+	first := webPod("concourse-web-0", true)
+	first.Status.PodIP = "10.1.0.4"
+	second := webPod("concourse-web-1", true)
+	second.Status.PodIP = "10.1.0.5"
+	dialer := &accounts.K8sWebPodDialer{
+		Pods: func() ([]corev1.Pod, error) {
+			return []corev1.Pod{first, second}, nil
+		},
+	}
+
+	pod, err := dialer.PodWithIP("10.1.0.5")
+
+	s.NoError(err)
+	s.Equal("concourse-web-1", pod)
+}
+
+func (s *K8sWebWorkloadSuite) TestK8sWebPodDialerOnlyLooksUpPodsOnce() {
+	pod := webPod("concourse-web-0", true)
+	pod.Status.PodIP = "10.1.0.4"
+	lookups := 0
+	dialer := &accounts.K8sWebPodDialer{
+		Pods: func() ([]corev1.Pod, error) {
+			lookups++
+			return []corev1.Pod{pod}, nil
+		},
+	}
+
+	_, err := dialer.PodWithIP("10.1.0.4")
+	s.NoError(err)
+	name, err := dialer.PodWithIP("10.1.0.4")
+
+	s.NoError(err)
+	s.Equal("concourse-web-0", name)
+	s.Equal(1, lookups)
+}
+
+func (s *K8sWebWorkloadSuite) TestK8sWebPodDialerFailsWithoutAPodWithTheWorkersIP() {
+	pod := webPod("concourse-web-0", true)
+	pod.Status.PodIP = "10.1.0.4"
+	dialer := &accounts.K8sWebPodDialer{
+		Pods: func() ([]corev1.Pod, error) {
+			return []corev1.Pod{pod}, nil
+		},
+	}
+
+	_, err := dialer.DialWeb("10.1.0.9:7777")
+
+	s.EqualError(err, "no web pod has the IP 10.1.0.9 the worker is forwarded to")
+}
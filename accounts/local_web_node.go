@@ -0,0 +1,277 @@
+package accounts
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// a LocalWebNode infers postgres settings from a web node on this machine,
+// either from the environment file or systemd unit it is started with, or
+// from the environment of its running process.
+type LocalWebNode struct {
+	EnvFile string
+	PID     int
+	// Proc is where procfs is mounted, /proc by default.
+	Proc string
+
+	env map[string]string
+}
+
+func (lwn *LocalWebNode) PostgresParamNames() ([]string, error) {
+	env, err := lwn.environment()
+	if err != nil {
+		return nil, err
+	}
+	return postgresParamNames(env), nil
+}
+
+func (lwn *LocalWebNode) ValueFromEnvVar(paramName string) (string, error) {
+	env, err := lwn.environment()
+	if err != nil {
+		return "", err
+	}
+	value, ok := env[paramName]
+	if !ok {
+		return "", fmt.Errorf("%s does not have '%s' specified", lwn.source(), paramName)
+	}
+	return value, nil
+}
+
+func (lwn *LocalWebNode) FileContentsFromEnvVar(paramName string) (string, error) {
+	path, err := lwn.ValueFromEnvVar(paramName)
+	if err != nil {
+		return "", err
+	}
+	contents, err := ioutil.ReadFile(lwn.localPath(path))
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+func (lwn *LocalWebNode) source() string {
+	if lwn.EnvFile != "" {
+		return lwn.EnvFile
+	}
+	return fmt.Sprintf("process %d", lwn.PID)
+}
+
+func (lwn *LocalWebNode) proc(parts ...string) string {
+	proc := lwn.Proc
+	if proc == "" {
+		proc = "/proc"
+	}
+	return filepath.Join(append([]string{proc, strconv.Itoa(lwn.PID)}, parts...)...)
+}
+
+// localPath finds a path the web node was given. A process sees paths from
+// its own root and working directory, which may not be this one's, i.e. when
+// it runs in a container.
+func (lwn *LocalWebNode) localPath(path string) string {
+	if lwn.EnvFile != "" {
+		return path
+	}
+	if filepath.IsAbs(path) {
+		return lwn.proc("root", path)
+	}
+	return lwn.proc("cwd", path)
+}
+
+func (lwn *LocalWebNode) environment() (map[string]string, error) {
+	if lwn.env != nil {
+		return lwn.env, nil
+	}
+	var (
+		env map[string]string
+		err error
+	)
+	if lwn.EnvFile != "" {
+		env, err = readEnvSource(lwn.EnvFile)
+	} else {
+		env, err = readProcEnviron(lwn.proc("environ"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	lwn.env = env
+	return env, nil
+}
+
+func readProcEnviron(path string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for _, pair := range bytes.Split(contents, []byte{0}) {
+		parts := strings.SplitN(string(pair), "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env, nil
+}
+
+// readEnvSource reads either a systemd unit or an environment file, telling
+// them apart by whether there are any [Section] headers.
+func readEnvSource(path string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := unitLines(string(contents))
+	for _, line := range lines {
+		if strings.HasPrefix(line, "[") {
+			return parseSystemdUnit(lines)
+		}
+	}
+	return parseEnvFile(lines), nil
+}
+
+// unitLines splits a file into lines, joining ones continued with a trailing
+// backslash and dropping blanks and comments.
+func unitLines(contents string) []string {
+	lines := []string{}
+	continued := ""
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if continued == "" && (line == "" || line[0] == '#' || line[0] == ';') {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			continued += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		lines = append(lines, continued+line)
+		continued = ""
+	}
+	if continued != "" {
+		lines = append(lines, strings.TrimSpace(continued))
+	}
+	return lines
+}
+
+// parseEnvFile reads the lines of a systemd EnvironmentFile, which are
+// KEY=VALUE pairs whose values may be quoted. An "export " in front, as in
+// files also sourced by shells, is ignored.
+func parseEnvFile(lines []string) map[string]string {
+	env := map[string]string{}
+	for _, line := range lines {
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		env[strings.TrimSpace(parts[0])] = unquote(strings.TrimSpace(parts[1]))
+	}
+	return env
+}
+
+// parseSystemdUnit collects the environment a unit's service is started with.
+// As in systemd, variables from EnvironmentFile= override ones set with
+// Environment=, and a file whose path starts with - may be missing.
+func parseSystemdUnit(lines []string) (map[string]string, error) {
+	env := map[string]string{}
+	files := []string{}
+	section := ""
+	for _, line := range lines {
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		if section != "[Service]" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "Environment":
+			// an empty assignment resets what came before it
+			if value == "" {
+				env = map[string]string{}
+			}
+			for _, assignment := range splitQuoted(value) {
+				pair := strings.SplitN(assignment, "=", 2)
+				if len(pair) == 2 {
+					env[pair[0]] = pair[1]
+				}
+			}
+		case "EnvironmentFile":
+			if value == "" {
+				files = nil
+			} else {
+				files = append(files, value)
+			}
+		}
+	}
+	for _, file := range files {
+		optional := strings.HasPrefix(file, "-")
+		file = strings.TrimPrefix(file, "-")
+		contents, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) && optional {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range parseEnvFile(unitLines(string(contents))) {
+			env[key] = value
+		}
+	}
+	return env, nil
+}
+
+// splitQuoted splits a value on spaces, except where they are quoted, and
+// unquotes the words.
+func splitQuoted(value string) []string {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	quote := rune(0)
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+			inWord = true
+		case quote == 0 && (r == ' ' || r == '\t'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 &&
+		(value[0] == '"' || value[0] == '\'') &&
+		value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
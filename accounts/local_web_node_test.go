@@ -0,0 +1,121 @@
+package accounts_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LocalWebNodeSuite struct {
+	suite.Suite
+	*require.Assertions
+	dir string
+}
+
+func (s *LocalWebNodeSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "ft-web-node")
+	s.NoError(err)
+}
+
+func (s *LocalWebNodeSuite) TearDownTest() {
+	os.RemoveAll(s.dir)
+}
+
+func (s *LocalWebNodeSuite) writeFile(name, contents string) string {
+	path := filepath.Join(s.dir, name)
+	s.NoError(os.MkdirAll(filepath.Dir(path), 0700))
+	s.NoError(ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func (s *LocalWebNodeSuite) TestReadsAnEnvironmentFile() {
+	caCert := s.writeFile("ca.crt", "some-cert")
+	envFile := s.writeFile("web.env", `
+# postgres
+CONCOURSE_POSTGRES_HOST=10.0.0.5
+export CONCOURSE_POSTGRES_USER="atc"
+CONCOURSE_POSTGRES_CA_CERT=`+caCert+`
+CONCOURSE_EXTERNAL_URL=https://ci.example.com
+`)
+	tracker := &accounts.TmpfsTracker{}
+	defer tracker.Clear()
+	opener := &accounts.WebNodeInferredPostgresOpener{
+		WebNode:     &accounts.LocalWebNode{EnvFile: envFile},
+		FileTracker: tracker,
+	}
+
+	postgresConfig, err := opener.PostgresConfig()
+
+	s.NoError(err)
+	s.Equal("10.0.0.5", postgresConfig.Host)
+	s.Equal("atc", postgresConfig.User)
+	contents, err := ioutil.ReadFile(postgresConfig.CACert.Path())
+	s.NoError(err)
+	s.Equal("some-cert", string(contents))
+}
+
+func (s *LocalWebNodeSuite) TestReadsASystemdUnit() {
+	envFile := s.writeFile("web.env", "CONCOURSE_POSTGRES_PASSWORD=from-file\n")
+	unit := s.writeFile("concourse-web.service", `[Unit]
+Description=concourse web
+Environment=CONCOURSE_POSTGRES_HOST=ignored
+
+[Service]
+Environment="CONCOURSE_POSTGRES_USER=atc" CONCOURSE_POSTGRES_DATABASE='concourse db'
+Environment=CONCOURSE_POSTGRES_HOST=10.0.0.5 \
+  CONCOURSE_POSTGRES_PASSWORD=overridden
+EnvironmentFile=`+envFile+`
+EnvironmentFile=-/does/not/exist
+ExecStart=/usr/local/bin/concourse web
+`)
+	webNode := &accounts.LocalWebNode{EnvFile: unit}
+
+	names, err := webNode.PostgresParamNames()
+	s.NoError(err)
+	s.Equal([]string{
+		"CONCOURSE_POSTGRES_DATABASE",
+		"CONCOURSE_POSTGRES_HOST",
+		"CONCOURSE_POSTGRES_PASSWORD",
+		"CONCOURSE_POSTGRES_USER",
+	}, names)
+	for param, expected := range map[string]string{
+		"CONCOURSE_POSTGRES_DATABASE": "concourse db",
+		"CONCOURSE_POSTGRES_HOST":     "10.0.0.5",
+		"CONCOURSE_POSTGRES_PASSWORD": "from-file",
+		"CONCOURSE_POSTGRES_USER":     "atc",
+	} {
+		value, err := webNode.ValueFromEnvVar(param)
+		s.NoError(err)
+		s.Equal(expected, value)
+	}
+}
+
+func (s *LocalWebNodeSuite) TestFailsForMissingEnvironmentFiles() {
+	unit := s.writeFile("concourse-web.service", "[Service]\nEnvironmentFile=/does/not/exist\n")
+	webNode := &accounts.LocalWebNode{EnvFile: unit}
+
+	_, err := webNode.PostgresParamNames()
+
+	s.Error(err)
+}
+
+func (s *LocalWebNodeSuite) TestReadsTheEnvironmentOfAProcess() {
+	s.writeFile("42/environ", "CONCOURSE_POSTGRES_HOST=db\x00CONCOURSE_POSTGRES_CA_CERT=/keys/ca.crt\x00HOME=/root\x00")
+	s.writeFile("42/root/keys/ca.crt", "some-cert")
+	webNode := &accounts.LocalWebNode{PID: 42, Proc: s.dir}
+
+	names, err := webNode.PostgresParamNames()
+	s.NoError(err)
+	caCert, err := webNode.FileContentsFromEnvVar("CONCOURSE_POSTGRES_CA_CERT")
+	s.NoError(err)
+	_, err = webNode.ValueFromEnvVar("CONCOURSE_POSTGRES_USER")
+
+	s.Equal([]string{"CONCOURSE_POSTGRES_CA_CERT", "CONCOURSE_POSTGRES_HOST"}, names)
+	s.Equal("some-cert", caCert)
+	s.EqualError(err, "process 42 does not have 'CONCOURSE_POSTGRES_USER' specified")
+}
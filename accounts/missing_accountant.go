@@ -0,0 +1,114 @@
+package accounts
+
+import (
+	"database/sql"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/atc/db"
+)
+
+// a MissingAccountant reports the containers the database thinks a worker
+// has, but which the worker no longer knows about. Their samples come from
+// Accountant, labelled with the worker they should have been on.
+type MissingAccountant struct {
+	Accountant Accountant
+	Opener     PostgresOpener
+	// Worker is the name the containers' worker is registered with, for
+	// containers which aren't labelled with theirs.
+	Worker string
+	// Workers, when set, are the workers to look for missing containers on,
+	// so that those which answered with no containers at all are too.
+	Workers WorkerSet
+}
+
+func (ma *MissingAccountant) Account(containers []Container) ([]Sample, error) {
+	conn, err := ma.Opener.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var workerNames []string
+	if ma.Workers != nil {
+		workerNames = ma.Workers.AnsweredWorkers()
+	} else {
+		workerNames, err = containerWorkers(containers, ma.Worker)
+		if err != nil {
+			return nil, err
+		}
+	}
+	missing, err := missingContainers(conn, containers, workerNames)
+	if err != nil {
+		return nil, err
+	}
+	return ma.Accountant.Account(missing)
+}
+
+// containerWorkers names the workers the given containers are on. Containers
+// which aren't labelled with their workers are on worker.
+func containerWorkers(containers []Container, worker string) ([]string, error) {
+	workerNames := []string{}
+	seen := map[string]bool{}
+	for _, container := range containers {
+		name := container.Worker
+		if name == "" {
+			name = worker
+		}
+		if name == "" {
+			return nil, fmt.Errorf(
+				"cannot tell which worker container '%s' is on",
+				container.Handle,
+			)
+		}
+		if !seen[name] {
+			seen[name] = true
+			workerNames = append(workerNames, name)
+		}
+	}
+	if len(workerNames) == 0 {
+		if worker == "" {
+			return nil, fmt.Errorf("cannot tell which worker to look for missing containers on")
+		}
+		workerNames = append(workerNames, worker)
+	}
+	return workerNames, nil
+}
+
+// missingContainers finds the created containers in the database which belong
+// to the named workers, but aren't among the given containers.
+func missingContainers(conn *sql.DB, containers []Container, workerNames []string) ([]Container, error) {
+	handles := []string{}
+	for _, container := range containers {
+		handles = append(handles, container.Handle)
+	}
+
+	rows, err := sq.StatementBuilder.
+		PlaceholderFormat(sq.Dollar).
+		Select("c.handle", "c.worker_name").
+		From("containers c").
+		Where(sq.And{
+			sq.Eq{"c.state": atc.ContainerStateCreated},
+			sq.Eq{"c.worker_name": workerNames},
+			sq.NotEq{"c.handle": handles},
+		}).
+		OrderBy("c.handle").
+		RunWith(conn).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []Container{}
+	defer db.Close(rows)
+	for rows.Next() {
+		var container Container
+		err = rows.Scan(&container.Handle, &container.Worker)
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, container)
+	}
+	return missing, nil
+}
@@ -0,0 +1,261 @@
+package accounts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// OutputChoices are the values accepted by the --output flag.
+var OutputChoices = []string{"table", "json", "yaml", "csv"}
+
+// a SampleRecord is the structured form of a Sample. Its fields are part of
+// ft's output format, so they should only ever be added to. Stats which
+// weren't measured are nil, and left out.
+type SampleRecord struct {
+	Handle      string           `json:"handle"`
+	Type        string           `json:"type"`
+	MemoryBytes uint64           `json:"memory_bytes"`
+	AgeSeconds  float64          `json:"age_seconds"`
+	Workloads   []WorkloadFields `json:"workloads"`
+	CPUSeconds  float64          `json:"cpu_seconds"`
+	CPUPercent  *float64         `json:"cpu_percent,omitempty"`
+	DiskBytes   *uint64          `json:"disk_bytes,omitempty"`
+	Processes   uint64           `json:"processes"`
+	OpenFiles   *uint64          `json:"open_files,omitempty"`
+	Worker      string           `json:"worker"`
+	// OpenFilesError is why open files couldn't be counted, in which case
+	// OpenFiles is left out.
+	OpenFilesError string `json:"open_files_error,omitempty"`
+}
+
+func NewSampleRecord(sample Sample) SampleRecord {
+	workloads := []WorkloadFields{}
+	for _, workload := range sample.Labels.Workloads {
+		workloads = append(workloads, workload.Fields())
+	}
+	openFilesError := ""
+	if sample.Container.Stats.OpenFilesError != nil {
+		openFilesError = sample.Container.Stats.OpenFilesError.Error()
+	}
+	var cpuPercent *float64
+	if sample.Container.Stats.CPUMeasured {
+		cpuPercent = &sample.Container.Stats.CPUPercent
+	}
+	var openFiles *uint64
+	if sample.Container.Stats.OpenFilesMeasured {
+		openFiles = &sample.Container.Stats.OpenFiles
+	}
+	var diskBytes *uint64
+	if sample.Container.Stats.DiskMeasured {
+		diskBytes = &sample.Container.Stats.Disk
+	}
+	return SampleRecord{
+		Handle:         sample.Container.Handle,
+		Type:           string(sample.Labels.Type),
+		MemoryBytes:    sample.Container.Stats.Memory,
+		AgeSeconds:     sample.Container.Stats.Age.Seconds(),
+		Workloads:      workloads,
+		CPUSeconds:     sample.Container.Stats.CPUTime.Seconds(),
+		CPUPercent:     cpuPercent,
+		DiskBytes:      diskBytes,
+		Processes:      sample.Container.Stats.Processes,
+		OpenFiles:      openFiles,
+		Worker:         sample.Labels.Worker,
+		OpenFilesError: openFilesError,
+	}
+}
+
+// a GroupRecord is the structured form of a Group.
+type GroupRecord struct {
+	Key              string  `json:"key"`
+	Containers       int     `json:"containers"`
+	TotalMemoryBytes uint64  `json:"total_memory_bytes"`
+	MaxMemoryBytes   uint64  `json:"max_memory_bytes"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+}
+
+func NewGroupRecord(group Group) GroupRecord {
+	return GroupRecord{
+		Key:              group.Key,
+		Containers:       group.Containers,
+		TotalMemoryBytes: group.TotalMemory,
+		MaxMemoryBytes:   group.MaxMemory,
+		OldestAgeSeconds: group.OldestAge.Seconds(),
+	}
+}
+
+func printOutput(writer io.Writer, cmd Command, samples []Sample) error {
+	if cmd.GroupBy != "" {
+		group := GroupSamples
+		if cmd.SplitShared {
+			group = SplitGroupSamples
+		}
+		groups, err := group(cmd.GroupBy, samples)
+		if err != nil {
+			return err
+		}
+		return printGroups(writer, cmd.Output, cmd.GroupBy, groups)
+	}
+	return printSamples(writer, cmd.Output, samples)
+}
+
+func printSamples(writer io.Writer, format string, samples []Sample) error {
+	if format == "" || format == "table" {
+		return printSampleTable(writer, samples)
+	}
+	records := []SampleRecord{}
+	for _, sample := range samples {
+		records = append(records, NewSampleRecord(sample))
+	}
+	if format == "csv" {
+		return writeCSV(writer, sampleCSVHeader, sampleCSVRows(records))
+	}
+	return writeStructured(writer, format, records)
+}
+
+func printGroups(writer io.Writer, format, by string, groups []Group) error {
+	if format == "" || format == "table" {
+		return printGroupTable(writer, by, groups)
+	}
+	records := []GroupRecord{}
+	for _, group := range groups {
+		records = append(records, NewGroupRecord(group))
+	}
+	if format == "csv" {
+		rows := [][]string{}
+		for _, r := range records {
+			rows = append(rows, []string{
+				r.Key,
+				strconv.Itoa(r.Containers),
+				strconv.FormatUint(r.TotalMemoryBytes, 10),
+				strconv.FormatUint(r.MaxMemoryBytes, 10),
+				formatFloat(r.OldestAgeSeconds),
+			})
+		}
+		return writeCSV(writer, groupCSVHeader, rows)
+	}
+	return writeStructured(writer, format, records)
+}
+
+var sampleCSVHeader = []string{
+	"handle",
+	"type",
+	"memory_bytes",
+	"age_seconds",
+	"team",
+	"pipeline",
+	"job",
+	"build",
+	"step",
+	"resource",
+	"cpu_seconds",
+	"cpu_percent",
+	"disk_bytes",
+	"processes",
+	"open_files",
+	"worker",
+}
+
+var groupCSVHeader = []string{
+	"key",
+	"containers",
+	"total_memory_bytes",
+	"max_memory_bytes",
+	"oldest_age_seconds",
+}
+
+// csv has no room for nested workloads, so a record gets one row per
+// workload and the container columns are repeated on each. Columns added
+// after the workload columns go at the end to keep existing ones in place.
+func sampleCSVRows(records []SampleRecord) [][]string {
+	rows := [][]string{}
+	for _, r := range records {
+		container := []string{
+			r.Handle,
+			r.Type,
+			strconv.FormatUint(r.MemoryBytes, 10),
+			formatFloat(r.AgeSeconds),
+		}
+		stats := []string{
+			formatFloat(r.CPUSeconds),
+			optionalFloat(r.CPUPercent),
+			optionalUint(r.DiskBytes),
+			strconv.FormatUint(r.Processes, 10),
+			optionalUint(r.OpenFiles),
+			r.Worker,
+		}
+		workloads := r.Workloads
+		if len(workloads) == 0 {
+			workloads = []WorkloadFields{{}}
+		}
+		for _, w := range workloads {
+			row := append([]string{}, container...)
+			row = append(row,
+				w.Team,
+				w.Pipeline,
+				w.Job,
+				w.Build,
+				w.Step,
+				w.Resource,
+			)
+			rows = append(rows, append(row, stats...))
+		}
+	}
+	return rows
+}
+
+// stats which weren't measured are left empty, rather than looking like
+// zeros.
+func optionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return formatFloat(*f)
+}
+
+func optionalUint(u *uint64) string {
+	if u == nil {
+		return ""
+	}
+	return strconv.FormatUint(*u, 10)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeCSV(writer io.Writer, header []string, rows [][]string) error {
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write(header)
+	if err != nil {
+		return err
+	}
+	err = csvWriter.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+	return csvWriter.Error()
+}
+
+func writeStructured(writer io.Writer, format string, v interface{}) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(out)
+		return err
+	default:
+		return fmt.Errorf("unknown output format '%s'", format)
+	}
+}
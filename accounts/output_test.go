@@ -0,0 +1,143 @@
+package accounts_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/concourse/concourse/atc/db"
+	"github.com/concourse/ft/accounts"
+	"github.com/concourse/ft/accounts/accountsfakes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type OutputSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *OutputSuite) execute(args ...string) string {
+	buf := bytes.NewBuffer([]byte{})
+	fakeWorker := new(accountsfakes.FakeWorker)
+	fakeAccountant := new(accountsfakes.FakeAccountant)
+	fakeAccountant.AccountReturns([]accounts.Sample{
+		{
+			Container: accounts.Container{
+				Handle: "abc123",
+				Stats: accounts.Stats{
+					Memory:            2048,
+					Age:               90 * time.Second,
+					CPUTime:           1500 * time.Millisecond,
+					CPUPercent:        12.5,
+					CPUMeasured:       true,
+					Disk:              4096,
+					DiskMeasured:      true,
+					Processes:         3,
+					OpenFiles:         42,
+					OpenFilesMeasured: true,
+				},
+			},
+			Labels: accounts.Labels{
+				Type: db.ContainerTypeCheck,
+				Workloads: []accounts.Workload{
+					testWorkload{accounts.WorkloadFields{
+						Team:     "main",
+						Pipeline: "p",
+						Resource: "r",
+					}},
+					testWorkload{accounts.WorkloadFields{
+						Team:     "main",
+						Pipeline: "p",
+						Resource: "s",
+					}},
+				},
+				Worker: "worker-1",
+			},
+		},
+	}, nil)
+
+	returnCode := accounts.Execute(
+		func(accounts.Command) (accounts.Worker, error) {
+			return fakeWorker, nil
+		}, func(accounts.Command) (accounts.Accountant, error) {
+			return fakeAccountant, nil
+		},
+		noopValidator,
+		args,
+		buf,
+	)
+	s.Equal(0, returnCode)
+	return buf.String()
+}
+
+func (s *OutputSuite) TestRendersJSON() {
+	s.JSONEq(`[
+		{
+			"handle": "abc123",
+			"type": "check",
+			"memory_bytes": 2048,
+			"age_seconds": 90,
+			"workloads": [
+				{"team": "main", "pipeline": "p", "job": "", "build": "", "step": "", "resource": "r"},
+				{"team": "main", "pipeline": "p", "job": "", "build": "", "step": "", "resource": "s"}
+			],
+			"cpu_seconds": 1.5,
+			"cpu_percent": 12.5,
+			"disk_bytes": 4096,
+			"processes": 3,
+			"open_files": 42,
+			"worker": "worker-1"
+		}
+	]`, s.execute("--output", "json"))
+}
+
+func (s *OutputSuite) TestRendersYAML() {
+	s.YAMLEq(`
+- handle: abc123
+  type: check
+  memory_bytes: 2048
+  age_seconds: 90
+  workloads:
+  - {team: main, pipeline: p, job: "", build: "", step: "", resource: r}
+  - {team: main, pipeline: p, job: "", build: "", step: "", resource: s}
+  cpu_seconds: 1.5
+  cpu_percent: 12.5
+  disk_bytes: 4096
+  processes: 3
+  open_files: 42
+  worker: worker-1
+`, s.execute("--output", "yaml"))
+}
+
+func (s *OutputSuite) TestRendersOneCSVRowPerWorkload() {
+	s.Equal(
+		"handle,type,memory_bytes,age_seconds,team,pipeline,job,build,step,resource,cpu_seconds,cpu_percent,disk_bytes,processes,open_files,worker\n"+
+			"abc123,check,2048,90,main,p,,,,r,1.5,12.5,4096,3,42,worker-1\n"+
+			"abc123,check,2048,90,main,p,,,,s,1.5,12.5,4096,3,42,worker-1\n",
+		s.execute("--output", "csv"),
+	)
+}
+
+func (s *OutputSuite) TestLeavesOutUnmeasuredStats() {
+	record := accounts.NewSampleRecord(accounts.Sample{
+		Container: accounts.Container{
+			Handle: "abc123",
+			Stats:  accounts.Stats{Memory: 2048},
+		},
+	})
+	out, err := json.Marshal(record)
+	s.NoError(err)
+
+	s.NotContains(string(out), "cpu_percent")
+	s.NotContains(string(out), "disk_bytes")
+	s.NotContains(string(out), `"open_files"`)
+}
+
+func (s *OutputSuite) TestRendersGroupsAsCSV() {
+	s.Equal(
+		"key,containers,total_memory_bytes,max_memory_bytes,oldest_age_seconds\n"+
+			"main/p,1,2048,2048,90\n",
+		s.execute("--output", "csv", "--group-by", "pipeline"),
+	)
+}
@@ -3,16 +3,21 @@ package accounts
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/concourse/flag"
 	"github.com/jessevdk/go-flags"
+	"github.com/lib/pq"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -33,11 +38,21 @@ func (spo *StaticPostgresOpener) Open() (*sql.DB, error) {
 type WebNodeInferredPostgresOpener struct {
 	WebNode     WebNode
 	FileTracker FileTracker
+	// Dialer reaches the inferred host when it can't be dialed directly,
+	// i.e. when it is only known inside a Kubernetes cluster.
+	Dialer pq.Dialer
 }
 
 type K8sClient interface {
 	GetPod(string) (*corev1.Pod, error)
-	GetSecret(string, string) (string, error)
+	GetService(string) (*corev1.Service, error)
+	ListPods(selector string) ([]corev1.Pod, error)
+	GetSecretData(string) (map[string]string, error)
+	GetConfigMapData(string) (map[string]string, error)
+	GetDeployment(string) (*appsv1.Deployment, error)
+	GetStatefulSet(string) (*appsv1.StatefulSet, error)
+	ListDeployments(selector string) ([]appsv1.Deployment, error)
+	ListStatefulSets(selector string) ([]appsv1.StatefulSet, error)
 }
 
 type k8sClient struct {
@@ -55,18 +70,115 @@ func (kc *k8sClient) GetPod(name string) (*corev1.Pod, error) {
 		Get(context.Background(), name, metav1.GetOptions{})
 }
 
-func (kc *k8sClient) GetSecret(name, key string) (string, error) {
+func (kc *k8sClient) GetService(name string) (*corev1.Service, error) {
 	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return clientset.CoreV1().
+		Services(kc.Namespace).
+		Get(context.Background(), name, metav1.GetOptions{})
+}
+
+func (kc *k8sClient) GetSecretData(name string) (map[string]string, error) {
+	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
+	if err != nil {
+		return nil, err
 	}
 	secret, err := clientset.CoreV1().
 		Secrets(kc.Namespace).
 		Get(context.Background(), name, metav1.GetOptions{})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	data := map[string]string{}
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	return data, nil
+}
+
+func (kc *k8sClient) GetConfigMapData(name string) (map[string]string, error) {
+	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	configMap, err := clientset.CoreV1().
+		ConfigMaps(kc.Namespace).
+		Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{}
+	for key, value := range configMap.BinaryData {
+		data[key] = string(value)
+	}
+	for key, value := range configMap.Data {
+		data[key] = value
+	}
+	return data, nil
+}
+
+func (kc *k8sClient) ListPods(selector string) ([]corev1.Pod, error) {
+	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := clientset.CoreV1().
+		Pods(kc.Namespace).
+		List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+func (kc *k8sClient) GetDeployment(name string) (*appsv1.Deployment, error) {
+	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	return clientset.AppsV1().
+		Deployments(kc.Namespace).
+		Get(context.Background(), name, metav1.GetOptions{})
+}
+
+func (kc *k8sClient) GetStatefulSet(name string) (*appsv1.StatefulSet, error) {
+	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	return clientset.AppsV1().
+		StatefulSets(kc.Namespace).
+		Get(context.Background(), name, metav1.GetOptions{})
+}
+
+func (kc *k8sClient) ListDeployments(selector string) ([]appsv1.Deployment, error) {
+	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	deployments, err := clientset.AppsV1().
+		Deployments(kc.Namespace).
+		List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
 	}
-	return string(secret.Data[key]), nil
+	return deployments.Items, nil
+}
+
+func (kc *k8sClient) ListStatefulSets(selector string) ([]appsv1.StatefulSet, error) {
+	clientset, err := kubernetes.NewForConfig(kc.RESTConfig)
+	if err != nil {
+		return nil, err
+	}
+	statefulSets, err := clientset.AppsV1().
+		StatefulSets(kc.Namespace).
+		List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return statefulSets.Items, nil
 }
 
 func NewK8sClient(restConfig *rest.Config, namespace string) K8sClient {
@@ -119,9 +231,17 @@ func (wnipo *WebNodeInferredPostgresOpener) Open() (*sql.DB, error) {
 		return nil, err
 	}
 	defer wnipo.FileTracker.Clear()
-	db, err := sql.Open("postgres", postgresConfig.ConnectionString())
-	if err != nil {
-		return nil, err
+	var db *sql.DB
+	if wnipo.Dialer != nil {
+		db = sql.OpenDB(&dialerConnector{
+			dsn:    postgresConfig.ConnectionString(),
+			dialer: wnipo.Dialer,
+		})
+	} else {
+		db, err = sql.Open("postgres", postgresConfig.ConnectionString())
+		if err != nil {
+			return nil, err
+		}
 	}
 	err = db.Ping()
 	if err != nil {
@@ -130,12 +250,39 @@ func (wnipo *WebNodeInferredPostgresOpener) Open() (*sql.DB, error) {
 	return db, nil
 }
 
+// a dialerConnector opens postgres connections through a dialer of its own.
+type dialerConnector struct {
+	dsn    string
+	dialer pq.Dialer
+}
+
+func (dc *dialerConnector) Connect(context.Context) (driver.Conn, error) {
+	return pq.DialOpen(dc.dialer, dc.dsn)
+}
+
+func (dc *dialerConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
 type WebNode interface {
 	PostgresParamNames() ([]string, error)
 	ValueFromEnvVar(string) (string, error)
 	FileContentsFromEnvVar(string) (string, error)
 }
 
+// postgresParamNames picks the names of the postgres settings out of a web
+// node's environment.
+func postgresParamNames(env map[string]string) []string {
+	names := []string{}
+	for name := range env {
+		if strings.HasPrefix(name, "CONCOURSE_POSTGRES_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func isFile(paramName string) bool {
 	switch paramName {
 	case "CONCOURSE_POSTGRES_CA_CERT",
@@ -159,7 +306,10 @@ func toFlagName(paramName string) string {
 func (wnipo *WebNodeInferredPostgresOpener) PostgresConfig() (flag.PostgresConfig, error) {
 	postgresConfig := flag.PostgresConfig{}
 	args := []string{}
-	paramNames, _ := wnipo.WebNode.PostgresParamNames()
+	paramNames, err := wnipo.WebNode.PostgresParamNames()
+	if err != nil {
+		return postgresConfig, err
+	}
 	for _, postgresParam := range paramNames {
 		value, err := wnipo.toFlagValue(postgresParam)
 		if err != nil {
@@ -194,129 +344,378 @@ func (wnipo *WebNodeInferredPostgresOpener) toFlagValue(
 	return value, nil
 }
 
-func tempfileFromString(contents string) (string, error) {
-	tmpfile, err := ioutil.TempFile("", "")
-	if err != nil {
-		return "", err
-	}
-	_, err = tmpfile.Write([]byte(contents))
-	if err != nil {
-		return "", err
-	}
-	err = tmpfile.Close()
-	if err != nil {
-		return "", err
-	}
-	return tmpfile.Name(), nil
+// an UnsupportedSourceError is returned for settings which come from
+// somewhere ft cannot read, i.e. a field of the pod or an emptyDir volume.
+type UnsupportedSourceError struct {
+	Param  string
+	Source string
+}
+
+func (use UnsupportedSourceError) Error() string {
+	return fmt.Sprintf("'%s' comes from %s, which is not supported", use.Param, use.Source)
 }
 
 type K8sWebPod struct {
 	Pod    *corev1.Pod
 	Client K8sClient
+	// Container is the name of the web container, when it can't be told apart
+	// by having "web" in its name.
+	Container string
+
+	// the data of secrets and config maps the container takes its whole
+	// environment from, by index into EnvFrom
+	envFrom map[int]map[string]string
 }
 
 func (wp *K8sWebPod) PostgresParamNames() ([]string, error) {
-	container, err := findWebContainer(wp.Pod.Spec)
+	container, err := findWebContainer(wp.Pod.Spec, wp.Container)
 	if err != nil {
 		return nil, err
 	}
 	names := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if strings.HasPrefix(name, "CONCOURSE_POSTGRES_") && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
 	for _, envVar := range container.Env {
-		if strings.HasPrefix(envVar.Name, "CONCOURSE_POSTGRES_") {
-			names = append(names, envVar.Name)
+		add(envVar.Name)
+	}
+	for i, source := range container.EnvFrom {
+		data, err := wp.envFromData(container, i)
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{}
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			add(source.Prefix + key)
 		}
 	}
 	return names, nil
 }
 
 func (wp *K8sWebPod) ValueFromEnvVar(paramName string) (string, error) {
-	container, err := findWebContainer(wp.Pod.Spec)
+	container, err := findWebContainer(wp.Pod.Spec, wp.Container)
 	if err != nil {
 		return "", err
 	}
-	for _, envVar := range container.Env {
-		if envVar.Name == paramName {
-			return wp.getParam(envVar)
-		}
+	value, found, err := wp.lookup(container, paramName, len(container.Env))
+	if err != nil {
+		return "", err
 	}
-	return "",
-		fmt.Errorf("container '%s' does not have '%s' specified",
-			container.Name,
-			paramName,
-		)
+	if !found {
+		return "",
+			fmt.Errorf("container '%s' does not have '%s' specified",
+				container.Name,
+				paramName,
+			)
+	}
+	return value, nil
 }
 
 func (wp *K8sWebPod) FileContentsFromEnvVar(paramName string) (string, error) {
-	container, err := findWebContainer(wp.Pod.Spec)
+	path, err := wp.ValueFromEnvVar(paramName)
 	if err != nil {
 		return "", err
 	}
-	for _, envVar := range container.Env {
-		if envVar.Name == paramName {
-			secretName, key, err := wp.secretForParam(container, envVar.Value)
+	container, err := findWebContainer(wp.Pod.Spec, wp.Container)
+	if err != nil {
+		return "", err
+	}
+	return wp.fileContents(container, paramName, path)
+}
+
+// lookup resolves a variable the way the kubelet would for the container's
+// process, as if it were defined before the env var at index before: later
+// env vars override earlier ones, which override ones from envFrom, of which
+// later sources override earlier ones.
+func (wp *K8sWebPod) lookup(container corev1.Container, name string, before int) (string, bool, error) {
+	for i := before - 1; i >= 0; i-- {
+		if container.Env[i].Name == name {
+			value, err := wp.resolve(container, i)
+			return value, err == nil, err
+		}
+	}
+	for i := len(container.EnvFrom) - 1; i >= 0; i-- {
+		prefix := container.EnvFrom[i].Prefix
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		data, err := wp.envFromData(container, i)
+		if err != nil {
+			return "", false, err
+		}
+		if value, ok := data[strings.TrimPrefix(name, prefix)]; ok {
+			return value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// resolve finds the value of the env var at index i, expanding the
+// $(VAR) references in literal values to the variables before it.
+func (wp *K8sWebPod) resolve(container corev1.Container, i int) (string, error) {
+	envVar := container.Env[i]
+	if envVar.ValueFrom == nil {
+		return expandEnvRefs(envVar.Value, func(name string) (string, bool, error) {
+			return wp.lookup(container, name, i)
+		})
+	}
+	source := envVar.ValueFrom
+	switch {
+	case source.SecretKeyRef != nil:
+		return wp.secretValue(source.SecretKeyRef.Name, source.SecretKeyRef.Key)
+	case source.ConfigMapKeyRef != nil:
+		return wp.configMapValue(source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key)
+	case source.FieldRef != nil:
+		return "", UnsupportedSourceError{
+			Param:  envVar.Name,
+			Source: "the pod's field '" + source.FieldRef.FieldPath + "'",
+		}
+	case source.ResourceFieldRef != nil:
+		return "", UnsupportedSourceError{
+			Param:  envVar.Name,
+			Source: "the container's resource '" + source.ResourceFieldRef.Resource + "'",
+		}
+	default:
+		return "", UnsupportedSourceError{Param: envVar.Name, Source: "an unknown source"}
+	}
+}
+
+// envFromData reads the secret or config map of one of the container's
+// envFrom sources. Optional ones which don't exist are empty.
+func (wp *K8sWebPod) envFromData(container corev1.Container, i int) (map[string]string, error) {
+	if data, ok := wp.envFrom[i]; ok {
+		return data, nil
+	}
+	source := container.EnvFrom[i]
+	var (
+		data     map[string]string
+		err      error
+		optional *bool
+	)
+	switch {
+	case source.SecretRef != nil:
+		data, err = wp.Client.GetSecretData(source.SecretRef.Name)
+		optional = source.SecretRef.Optional
+	case source.ConfigMapRef != nil:
+		data, err = wp.Client.GetConfigMapData(source.ConfigMapRef.Name)
+		optional = source.ConfigMapRef.Optional
+	default:
+		return nil, UnsupportedSourceError{
+			Param:  source.Prefix + "*",
+			Source: "an unknown envFrom source",
+		}
+	}
+	if apierrors.IsNotFound(err) && optional != nil && *optional {
+		data, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wp.envFrom == nil {
+		wp.envFrom = map[int]map[string]string{}
+	}
+	wp.envFrom[i] = data
+	return data, nil
+}
+
+// expandEnvRefs replaces $(VAR) references with the values lookup finds for
+// them. As in Kubernetes, $$ escapes a $ and references to variables which
+// aren't defined are left as they are.
+func expandEnvRefs(value string, lookup func(string) (string, bool, error)) (string, error) {
+	var expanded strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			expanded.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case '$':
+			expanded.WriteByte('$')
+			i++
+		case '(':
+			end := strings.IndexByte(value[i+2:], ')')
+			if end < 0 {
+				expanded.WriteString(value[i:])
+				return expanded.String(), nil
+			}
+			name := value[i+2 : i+2+end]
+			resolved, found, err := lookup(name)
 			if err != nil {
 				return "", err
 			}
-			return wp.Client.GetSecret(secretName, key)
+			if found {
+				expanded.WriteString(resolved)
+			} else {
+				expanded.WriteString("$(" + name + ")")
+			}
+			i += 2 + end
+		default:
+			expanded.WriteByte('$')
 		}
 	}
-	return "", nil
+	return expanded.String(), nil
 }
 
-func (wp *K8sWebPod) secretForParam(container corev1.Container, paramValue string) (string, string, error) {
-	// find the VolumeMount whose MountPath is a prefix for paramValue
+// fileContents reads a file in the container from the secret or config map
+// mounted where it is, directly or through a projected volume.
+func (wp *K8sWebPod) fileContents(container corev1.Container, paramName, path string) (string, error) {
+	// the innermost mount the path is in is the one it comes from
 	var volumeMount *corev1.VolumeMount
-	for _, vm := range container.VolumeMounts {
-		if strings.HasPrefix(paramValue, vm.MountPath) {
-			volumeMount = &vm
-			break
+	for i, vm := range container.VolumeMounts {
+		if path != vm.MountPath && !strings.HasPrefix(path, strings.TrimSuffix(vm.MountPath, "/")+"/") {
+			continue
+		}
+		if volumeMount == nil || len(vm.MountPath) > len(volumeMount.MountPath) {
+			volumeMount = &container.VolumeMounts[i]
 		}
 	}
 	if volumeMount == nil {
-		return "", "", fmt.Errorf(
+		return "", fmt.Errorf(
 			"container has no volume mounts matching '%s'",
-			paramValue,
+			path,
 		)
 	}
 	var volume *corev1.Volume
-	for _, v := range wp.Pod.Spec.Volumes {
+	for i, v := range wp.Pod.Spec.Volumes {
 		if v.Name == volumeMount.Name {
-			volume = &v
+			volume = &wp.Pod.Spec.Volumes[i]
 			break
 		}
 	}
 	if volume == nil {
-		return "", "", fmt.Errorf(
+		return "", fmt.Errorf(
 			"pod has no volume named '%s'",
 			volumeMount.Name,
 		)
 	}
-	// TODO: test when this fails -- maybe filesystem paths don't get
-	// constructed quite how you imagine? symlinks!?
-	// find the item whose path matches the envVar
-	var item corev1.KeyToPath
-	for _, i := range volume.VolumeSource.Secret.Items {
-		if paramValue == volumeMount.MountPath+"/"+i.Path {
-			item = i
+	// the path of the file within the volume
+	rel := strings.TrimPrefix(strings.TrimPrefix(path, volumeMount.MountPath), "/")
+	if volumeMount.SubPath != "" {
+		rel = strings.TrimSuffix(volumeMount.SubPath+"/"+rel, "/")
+	}
+
+	source := volume.VolumeSource
+	switch {
+	case source.Secret != nil:
+		key, ok := projectedKey(source.Secret.Items, rel)
+		if !ok {
+			return "", fmt.Errorf(
+				"volume '%s' has no item at '%s'",
+				volume.Name,
+				rel,
+			)
+		}
+		return wp.secretValue(source.Secret.SecretName, key)
+	case source.ConfigMap != nil:
+		key, ok := projectedKey(source.ConfigMap.Items, rel)
+		if !ok {
+			return "", fmt.Errorf(
+				"volume '%s' has no item at '%s'",
+				volume.Name,
+				rel,
+			)
+		}
+		return wp.configMapValue(source.ConfigMap.Name, key)
+	case source.Projected != nil:
+		for _, projection := range source.Projected.Sources {
+			switch {
+			case projection.Secret != nil:
+				key, ok := projectedKey(projection.Secret.Items, rel)
+				if !ok {
+					continue
+				}
+				data, err := wp.Client.GetSecretData(projection.Secret.Name)
+				if err != nil {
+					return "", err
+				}
+				if value, ok := data[key]; ok {
+					return value, nil
+				}
+			case projection.ConfigMap != nil:
+				key, ok := projectedKey(projection.ConfigMap.Items, rel)
+				if !ok {
+					continue
+				}
+				data, err := wp.Client.GetConfigMapData(projection.ConfigMap.Name)
+				if err != nil {
+					return "", err
+				}
+				if value, ok := data[key]; ok {
+					return value, nil
+				}
+			}
+		}
+		return "", UnsupportedSourceError{
+			Param:  paramName,
+			Source: "projected volume '" + volume.Name + "' with no secret or config map providing it",
+		}
+	default:
+		return "", UnsupportedSourceError{
+			Param:  paramName,
+			Source: "volume '" + volume.Name + "', which is not a secret, config map or projected volume",
 		}
 	}
-	secretName := volume.VolumeSource.Secret.SecretName
-	key := item.Key
-	return secretName, key, nil
 }
 
-func (wp *K8sWebPod) getParam(envVar corev1.EnvVar) (string, error) {
-	if envVar.Value != "" {
-		return envVar.Value, nil
-	} else {
-		secretKeyRef := envVar.ValueFrom.SecretKeyRef
-		secretName := secretKeyRef.LocalObjectReference.Name
-		key := secretKeyRef.Key
-		return wp.Client.GetSecret(secretName, key)
+func (wp *K8sWebPod) secretValue(name, key string) (string, error) {
+	data, err := wp.Client.GetSecretData(name)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' has no key '%s'", name, key)
+	}
+	return value, nil
+}
+
+func (wp *K8sWebPod) configMapValue(name, key string) (string, error) {
+	data, err := wp.Client.GetConfigMapData(name)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("config map '%s' has no key '%s'", name, key)
 	}
+	return value, nil
 }
 
-func findWebContainer(spec corev1.PodSpec) (corev1.Container, error) {
+// projectedKey finds the key of a secret or config map which is mounted at a
+// path in a volume. Without items, each key is mounted as a file of its own
+// name.
+func projectedKey(items []corev1.KeyToPath, path string) (string, bool) {
+	if len(items) == 0 {
+		return path, true
+	}
+	for _, item := range items {
+		if item.Path == path {
+			return item.Key, true
+		}
+	}
+	return "", false
+}
+
+// findWebContainer finds the container of a pod that runs concourse web,
+// which is the one named container if given, or otherwise the only one with
+// "web" in its name.
+func findWebContainer(spec corev1.PodSpec, name string) (corev1.Container, error) {
+	if name != "" {
+		for _, c := range spec.Containers {
+			if c.Name == name {
+				return c, nil
+			}
+		}
+		return corev1.Container{}, fmt.Errorf("could not find a container named '%s'", name)
+	}
 	var (
 		container corev1.Container
 		found     bool
@@ -94,9 +94,13 @@ type testWebNode struct {
 	sslkey      string
 	sslcert     string
 	valueError  bool
+	namesError  bool
 }
 
 func (twp *testWebNode) PostgresParamNames() ([]string, error) {
+	if twp.namesError {
+		return nil, errors.New("no env")
+	}
 	names := []string{}
 	if twp.host != "" {
 		names = append(names, "CONCOURSE_POSTGRES_HOST")
@@ -182,6 +186,41 @@ func (s *PostgresOpenerSuite) TestInfersPostgresConnectionFromWebNode() {
 	s.NoError(err)
 }
 
+type testPostgresDialer struct {
+	addr   string
+	dialed []string
+}
+
+func (tpd *testPostgresDialer) Dial(network, address string) (net.Conn, error) {
+	tpd.dialed = append(tpd.dialed, address)
+	return net.Dial(network, tpd.addr)
+}
+
+func (tpd *testPostgresDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	return tpd.Dial(network, address)
+}
+
+func (s *PostgresOpenerSuite) TestDialsInferredHostThroughDialer() {
+	port, pg := s.fakePostgres(nil)
+	defer pg.Close()
+	dialer := &testPostgresDialer{addr: "127.0.0.1:" + port}
+	opener := &accounts.WebNodeInferredPostgresOpener{
+		WebNode: &testWebNode{
+			name:     "helm-release-web",
+			host:     "helm-release-postgresql",
+			port:     "5432",
+			user:     "postgres",
+			password: "password",
+		},
+		FileTracker: &accounts.TmpfsTracker{},
+		Dialer:      dialer,
+	}
+
+	_, err := opener.Open()
+	s.NoError(err)
+	s.Equal([]string{"helm-release-postgresql:5432"}, dialer.dialed)
+}
+
 func (s *PostgresOpenerSuite) generateKeyPair() ([]byte, []byte) {
 	priv, err := rsa.GenerateKey(rand.Reader, 4096)
 	s.NoError(err)
@@ -312,6 +351,16 @@ func (s *PostgresOpenerSuite) TestFailsWhenValueLookupErrors() {
 	s.EqualError(err, "foobar")
 }
 
+func (s *PostgresOpenerSuite) TestFailsWhenParamNamesLookupErrors() {
+	opener := &accounts.WebNodeInferredPostgresOpener{
+		WebNode: &testWebNode{namesError: true},
+	}
+
+	_, err := opener.PostgresConfig()
+
+	s.EqualError(err, "no env")
+}
+
 func (s *PostgresOpenerSuite) TestFailsWhenRootCertLookupErrors() {
 	container := corev1.Container{
 		Name: "helm-release-web",
@@ -18,40 +18,61 @@ func (rw ResourceWorkload) ToString() string {
 	return fmt.Sprintf("%s/%s/%s", rw.teamName, rw.pipelineName, rw.resourceName)
 }
 
+func (rw ResourceWorkload) Fields() WorkloadFields {
+	return WorkloadFields{
+		Team:     rw.teamName,
+		Pipeline: rw.pipelineName,
+		Resource: rw.resourceName,
+	}
+}
+
+// a ResourceTypeWorkload is the check of a pipeline's custom resource type.
+type ResourceTypeWorkload struct {
+	resourceTypeName string
+	pipelineName     string
+	teamName         string
+}
+
+func (rtw ResourceTypeWorkload) ToString() string {
+	return fmt.Sprintf("%s/%s/type:%s", rtw.teamName, rtw.pipelineName, rtw.resourceTypeName)
+}
+
+func (rtw ResourceTypeWorkload) Fields() WorkloadFields {
+	return WorkloadFields{
+		Team:     rtw.teamName,
+		Pipeline: rtw.pipelineName,
+		Resource: "type:" + rtw.resourceTypeName,
+	}
+}
+
 func resourceSamples(
 	conn *sql.DB,
 	containers []Container,
+	filter WorkloadFilter,
+	instanceVars string,
 ) ([]Sample, error) {
-	rows, err := sq.StatementBuilder.
-		PlaceholderFormat(sq.Dollar).
-		Select("c.handle", "r.name", "p.name", "t.name").
-		From("containers c").
-		Join("resource_config_check_sessions rccs on c.resource_config_check_session_id = rccs.id").
-		Join("resources r on rccs.resource_config_id = r.resource_config_id").
-		Join("pipelines p on r.pipeline_id = p.id").
-		Join("teams t on p.team_id = t.id").
-		Where(filterHandles(containers)).
-		RunWith(conn).
-		Query()
+	workloads := map[string][]Workload{}
+	// resources and resource types are checked the same way, so their
+	// containers are found through the same check sessions
+	err := checkWorkloads(conn, containers, filter, instanceVars, "resources", workloads, func(name, pipeline, team string) Workload {
+		return &ResourceWorkload{
+			resourceName: name,
+			pipelineName: pipeline,
+			teamName:     team,
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	workloads := map[string][]Workload{}
-	defer db.Close(rows)
-	for rows.Next() {
-		resource := ResourceWorkload{}
-		var handle string
-		err = rows.Scan(
-			&handle,
-			&resource.resourceName,
-			&resource.pipelineName,
-			&resource.teamName,
-		)
-		if err != nil {
-			return nil, err
+	err = checkWorkloads(conn, containers, filter, instanceVars, "resource_types", workloads, func(name, pipeline, team string) Workload {
+		return &ResourceTypeWorkload{
+			resourceTypeName: name,
+			pipelineName:     pipeline,
+			teamName:         team,
 		}
-		workloads[handle] = append(workloads[handle], &resource)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	var samples []Sample
@@ -69,3 +90,49 @@ func resourceSamples(
 
 	return samples, nil
 }
+
+// checkWorkloads adds a workload to workloads for every row of table whose
+// resource config one of the containers is checking.
+func checkWorkloads(
+	conn *sql.DB,
+	containers []Container,
+	filter WorkloadFilter,
+	instanceVars string,
+	table string,
+	workloads map[string][]Workload,
+	workload func(name, pipeline, team string) Workload,
+) error {
+	rows, err := sq.StatementBuilder.
+		PlaceholderFormat(sq.Dollar).
+		Select("c.handle", "r.name", "p.name", instanceVars, "t.name").
+		From("containers c").
+		Join("resource_config_check_sessions rccs on c.resource_config_check_session_id = rccs.id").
+		Join(table + " r on rccs.resource_config_id = r.resource_config_id").
+		Join("pipelines p on r.pipeline_id = p.id").
+		Join("teams t on p.team_id = t.id").
+		Where(sq.And{
+			filterHandles(containers),
+			filter.conditions("t.name", "p.name"),
+		}).
+		RunWith(conn).
+		Query()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close(rows)
+	for rows.Next() {
+		var handle, name, pipelineName, teamName string
+		var pipelineInstanceVars sql.NullString
+		err = rows.Scan(&handle, &name, &pipelineName, &pipelineInstanceVars, &teamName)
+		if err != nil {
+			return err
+		}
+		pipelineName, err = pipelineRef(pipelineName, pipelineInstanceVars)
+		if err != nil {
+			return err
+		}
+		workloads[handle] = append(workloads[handle], workload(name, pipelineName, teamName))
+	}
+	return rows.Err()
+}
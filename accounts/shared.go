@@ -0,0 +1,111 @@
+package accounts
+
+import (
+	"io"
+	"sort"
+
+	"github.com/concourse/concourse/fly/ui"
+	"github.com/fatih/color"
+)
+
+// a SharedContainer is a container with more than one workload, i.e. a check
+// container for resources of the same type and source. Concourse shares
+// these across pipelines and teams, which is worth knowing when deciding
+// whose container it is.
+type SharedContainer struct {
+	Sample  Sample
+	Sharers []WorkloadFields
+	// Shares are the memory down to each of Sharers, if the container's
+	// memory is divided evenly between them. The first also gets the bytes
+	// left over.
+	Shares []uint64
+}
+
+// SharedContainers picks out the shared containers from samples, the ones
+// shared most widely first.
+func SharedContainers(samples []Sample) []SharedContainer {
+	shared := []SharedContainer{}
+	for _, sample := range samples {
+		workloads := sample.Labels.Workloads
+		if len(workloads) < 2 {
+			continue
+		}
+		sharers := []WorkloadFields{}
+		weights := []int{}
+		for _, workload := range workloads {
+			sharers = append(sharers, workload.Fields())
+			weights = append(weights, 1)
+		}
+		sort.Slice(sharers, func(i, j int) bool {
+			if sharers[i].Team != sharers[j].Team {
+				return sharers[i].Team < sharers[j].Team
+			}
+			if sharers[i].Pipeline != sharers[j].Pipeline {
+				return sharers[i].Pipeline < sharers[j].Pipeline
+			}
+			return sharers[i].Resource < sharers[j].Resource
+		})
+		shared = append(shared, SharedContainer{
+			Sample:  sample,
+			Sharers: sharers,
+			Shares:  divideMemory(sample.Container.Stats.Memory, weights),
+		})
+	}
+	sort.SliceStable(shared, func(i, j int) bool {
+		return len(shared[i].Sharers) > len(shared[j].Sharers)
+	})
+	return shared
+}
+
+// printSharedTable lists each shared container's sharers on rows of their
+// own, with the container's handle and memory on the first.
+func printSharedTable(writer io.Writer, shared []SharedContainer) error {
+	data := []ui.TableRow{}
+	for _, container := range shared {
+		for i, sharer := range container.Sharers {
+			handle, memory := "", ""
+			if i == 0 {
+				handle = container.Sample.Container.Handle
+				memory = humanReadable(container.Sample.Container.Stats.Memory)
+			}
+			data = append(data, ui.TableRow{
+				ui.TableCell{Contents: handle},
+				ui.TableCell{Contents: memory},
+				ui.TableCell{Contents: sharer.Team},
+				ui.TableCell{Contents: sharer.Pipeline},
+				ui.TableCell{Contents: sharer.Resource},
+				ui.TableCell{Contents: humanReadable(container.Shares[i])},
+			})
+		}
+	}
+	table := ui.Table{
+		Headers: ui.TableRow{
+			ui.TableCell{
+				Contents: "handle",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "memory",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "team",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "pipeline",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "resource",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "share",
+				Color:    color.New(color.Bold),
+			},
+		},
+		Data: data,
+	}
+	return table.Render(writer, true)
+}
@@ -0,0 +1,131 @@
+package accounts_test
+
+import (
+	"bytes"
+
+	"github.com/concourse/ft/accounts"
+	"github.com/concourse/ft/accounts/accountsfakes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SharedSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func sharedSample(handle string, memory uint64, sharers ...accounts.WorkloadFields) accounts.Sample {
+	workloads := []accounts.Workload{}
+	for _, sharer := range sharers {
+		workloads = append(workloads, testWorkload{sharer})
+	}
+	return accounts.Sample{
+		Container: accounts.Container{
+			Handle: handle,
+			Stats:  accounts.Stats{Memory: memory},
+		},
+		Labels: accounts.Labels{Workloads: workloads},
+	}
+}
+
+func (s *SharedSuite) TestPicksOutContainersWithSeveralWorkloads() {
+	shared := accounts.SharedContainers([]accounts.Sample{
+		sharedSample("alone", 100, accounts.WorkloadFields{Team: "main", Pipeline: "p", Resource: "r"}),
+		sharedSample(
+			"pair",
+			100,
+			accounts.WorkloadFields{Team: "other", Pipeline: "q", Resource: "s"},
+			accounts.WorkloadFields{Team: "main", Pipeline: "p", Resource: "r"},
+		),
+		sharedSample(
+			"trio",
+			300,
+			accounts.WorkloadFields{Team: "main", Pipeline: "p", Resource: "a"},
+			accounts.WorkloadFields{Team: "main", Pipeline: "p", Resource: "b"},
+			accounts.WorkloadFields{Team: "main", Pipeline: "q", Resource: "a"},
+		),
+	})
+
+	s.Len(shared, 2)
+	s.Equal("trio", shared[0].Sample.Container.Handle)
+	s.Equal([]uint64{100, 100, 100}, shared[0].Shares)
+	s.Equal("pair", shared[1].Sample.Container.Handle)
+	s.Equal([]uint64{50, 50}, shared[1].Shares)
+	s.Equal([]accounts.WorkloadFields{
+		{Team: "main", Pipeline: "p", Resource: "r"},
+		{Team: "other", Pipeline: "q", Resource: "s"},
+	}, shared[1].Sharers)
+}
+
+func (s *SharedSuite) TestListsEachSharerOfAContainer() {
+	fakeWorker := new(accountsfakes.FakeWorker)
+	fakeAccountant := new(accountsfakes.FakeAccountant)
+	fakeAccountant.AccountReturns([]accounts.Sample{
+		sharedSample(
+			"pair",
+			2048,
+			accounts.WorkloadFields{Team: "main", Pipeline: "p", Resource: "r"},
+			accounts.WorkloadFields{Team: "other", Pipeline: "q", Resource: "s"},
+		),
+	}, nil)
+	buf := bytes.NewBuffer([]byte{})
+
+	returnCode := accounts.Execute(
+		func(accounts.Command) (accounts.Worker, error) {
+			return fakeWorker, nil
+		}, func(accounts.Command) (accounts.Accountant, error) {
+			return fakeAccountant, nil
+		},
+		noopValidator,
+		[]string{"shared"},
+		buf,
+	)
+
+	s.Equal(0, returnCode)
+	s.Regexp(`pair\s+2.0 KB\s+main\s+p\s+r\s+1024 B`, buf.String())
+	s.Regexp(`\n\s+other\s+q\s+s\s+1024 B`, buf.String())
+}
+
+func (s *SharedSuite) TestSplitGroupingDividesSharedMemory() {
+	groups, err := accounts.SplitGroupSamples("team", []accounts.Sample{
+		sharedSample(
+			"trio",
+			300,
+			accounts.WorkloadFields{Team: "main", Pipeline: "p"},
+			accounts.WorkloadFields{Team: "main", Pipeline: "q"},
+			accounts.WorkloadFields{Team: "other", Pipeline: "p"},
+		),
+		sharedSample("alone", 50, accounts.WorkloadFields{Team: "other", Pipeline: "p"}),
+	})
+
+	s.NoError(err)
+	s.Equal([]accounts.Group{
+		{Key: "main", Containers: 1, TotalMemory: 200, MaxMemory: 200},
+		{Key: "other", Containers: 2, TotalMemory: 150, MaxMemory: 100},
+	}, groups)
+}
+
+func (s *SharedSuite) TestSplitGroupingGivesTheRemainderToTheFirstGroup() {
+	groups, err := accounts.SplitGroupSamples("team", []accounts.Sample{
+		sharedSample(
+			"trio",
+			100,
+			accounts.WorkloadFields{Team: "main", Pipeline: "p"},
+			accounts.WorkloadFields{Team: "other", Pipeline: "p"},
+			accounts.WorkloadFields{Team: "third", Pipeline: "p"},
+		),
+	})
+
+	s.NoError(err)
+	s.Equal([]accounts.Group{
+		{Key: "main", Containers: 1, TotalMemory: 34, MaxMemory: 34},
+		{Key: "other", Containers: 1, TotalMemory: 33, MaxMemory: 33},
+		{Key: "third", Containers: 1, TotalMemory: 33, MaxMemory: 33},
+	}, groups)
+}
+
+func (s *SharedSuite) TestSplitSharedNeedsGroupBy() {
+	err := accounts.DefaultValidator(accounts.Command{SplitShared: true})
+
+	s.EqualError(err, "--split-shared needs --group-by")
+}
@@ -0,0 +1,428 @@
+package accounts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/concourse/concourse/fly/ui"
+	"github.com/fatih/color"
+	bolt "go.etcd.io/bbolt"
+)
+
+// a Snapshot is the accounts of a worker's containers at one point in time,
+// kept so they can be compared with later ones.
+type Snapshot struct {
+	Time    time.Time        `json:"time"`
+	Samples []SnapshotSample `json:"samples"`
+}
+
+// a SnapshotSample is a SampleRecord along with the names of its workloads,
+// as they are shown in tables.
+type SnapshotSample struct {
+	SampleRecord
+	WorkloadNames []string `json:"workload_names"`
+}
+
+func NewSnapshot(now time.Time, samples []Sample) Snapshot {
+	snapshot := Snapshot{Time: now.UTC(), Samples: []SnapshotSample{}}
+	for _, sample := range samples {
+		names := []string{}
+		for _, workload := range sample.Labels.Workloads {
+			names = append(names, workload.ToString())
+		}
+		snapshot.Samples = append(snapshot.Samples, SnapshotSample{
+			SampleRecord:  NewSampleRecord(sample),
+			WorkloadNames: names,
+		})
+	}
+	return snapshot
+}
+
+var snapshotsBucket = []byte("snapshots")
+
+// snapshot keys are their times, in a format which sorts the same way
+const snapshotKeyFormat = "2006-01-02T15:04:05.000000000Z"
+
+// a SnapshotStore keeps snapshots in a BoltDB file, in the order they were
+// taken.
+type SnapshotStore struct {
+	Path string
+}
+
+func (ss *SnapshotStore) Append(snapshot Snapshot) error {
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	store, err := bolt.Open(ss.Path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		if err != nil {
+			return err
+		}
+		key := []byte(snapshot.Time.UTC().Format(snapshotKeyFormat))
+		return bucket.Put(key, value)
+	})
+}
+
+// At returns the last snapshot taken at or before t.
+func (ss *SnapshotStore) At(t time.Time) (Snapshot, error) {
+	var snapshot Snapshot
+	err := ss.view(func(bucket *bolt.Bucket) error {
+		key := []byte(t.UTC().Format(snapshotKeyFormat))
+		cursor := bucket.Cursor()
+		k, v := cursor.Seek(key)
+		if k == nil || string(k) != string(key) {
+			k, v = cursor.Prev()
+		}
+		if k == nil {
+			return fmt.Errorf("no snapshot at or before %s", t.Format(time.RFC3339))
+		}
+		return json.Unmarshal(v, &snapshot)
+	})
+	return snapshot, err
+}
+
+// Between returns the snapshots taken from since until until, oldest first.
+func (ss *SnapshotStore) Between(since, until time.Time) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	err := ss.view(func(bucket *bolt.Bucket) error {
+		min := []byte(since.UTC().Format(snapshotKeyFormat))
+		max := until.UTC().Format(snapshotKeyFormat)
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(min); k != nil && string(k) <= max; k, v = cursor.Next() {
+			var snapshot Snapshot
+			err := json.Unmarshal(v, &snapshot)
+			if err != nil {
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+func (ss *SnapshotStore) view(fn func(*bolt.Bucket) error) error {
+	// opening a file that isn't there read-only would create it first
+	if _, err := os.Stat(ss.Path); err != nil {
+		return err
+	}
+	store, err := bolt.Open(ss.Path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotsBucket)
+		if bucket == nil {
+			return fmt.Errorf("no snapshots recorded in %s", ss.Path)
+		}
+		return fn(bucket)
+	})
+}
+
+// ParseSnapshotTime reads a time given on the command line, either in full
+// as RFC3339, as a date and time, or as a time of day. Times without a zone
+// are local, and times of day are on the day of now.
+func ParseSnapshotTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, now.Location()); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			year, month, day := now.Date()
+			return time.Date(
+				year, month, day,
+				t.Hour(), t.Minute(), t.Second(), 0,
+				now.Location(),
+			), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(
+		"invalid time '%s', must be RFC3339, 'YYYY-MM-DD HH:MM' or 'HH:MM'",
+		s,
+	)
+}
+
+// a SnapshotDiff is what changed between two snapshots.
+type SnapshotDiff struct {
+	Before    Snapshot
+	After     Snapshot
+	Created   []SnapshotSample
+	Destroyed []SnapshotSample
+	Workloads []WorkloadDelta
+}
+
+// a WorkloadDelta is how the memory used by a workload's containers changed.
+type WorkloadDelta struct {
+	Workload string
+	Before   uint64
+	After    uint64
+}
+
+func (wd WorkloadDelta) change() int64 {
+	return int64(wd.After) - int64(wd.Before)
+}
+
+// DiffSnapshots compares two snapshots by container handle. Workloads whose
+// memory didn't change are left out, the others are listed by how much it
+// changed, most first.
+func DiffSnapshots(before, after Snapshot) SnapshotDiff {
+	diff := SnapshotDiff{
+		Before:    before,
+		After:     after,
+		Created:   []SnapshotSample{},
+		Destroyed: []SnapshotSample{},
+		Workloads: []WorkloadDelta{},
+	}
+	beforeHandles := snapshotHandles(before)
+	afterHandles := snapshotHandles(after)
+	for _, sample := range after.Samples {
+		if !beforeHandles[sample.Handle] {
+			diff.Created = append(diff.Created, sample)
+		}
+	}
+	for _, sample := range before.Samples {
+		if !afterHandles[sample.Handle] {
+			diff.Destroyed = append(diff.Destroyed, sample)
+		}
+	}
+	deltas := map[string]*WorkloadDelta{}
+	delta := func(name string) *WorkloadDelta {
+		if _, ok := deltas[name]; !ok {
+			deltas[name] = &WorkloadDelta{Workload: name}
+		}
+		return deltas[name]
+	}
+	for _, sample := range before.Samples {
+		for _, name := range snapshotWorkloadNames(sample) {
+			delta(name).Before += sample.MemoryBytes
+		}
+	}
+	for _, sample := range after.Samples {
+		for _, name := range snapshotWorkloadNames(sample) {
+			delta(name).After += sample.MemoryBytes
+		}
+	}
+	for _, delta := range deltas {
+		if delta.change() != 0 {
+			diff.Workloads = append(diff.Workloads, *delta)
+		}
+	}
+	sort.Slice(diff.Workloads, func(i, j int) bool {
+		ci, cj := abs(diff.Workloads[i].change()), abs(diff.Workloads[j].change())
+		if ci != cj {
+			return ci > cj
+		}
+		return diff.Workloads[i].Workload < diff.Workloads[j].Workload
+	})
+	return diff
+}
+
+func snapshotHandles(snapshot Snapshot) map[string]bool {
+	handles := map[string]bool{}
+	for _, sample := range snapshot.Samples {
+		handles[sample.Handle] = true
+	}
+	return handles
+}
+
+// containers without workloads are all put down to nobody in particular, as
+// when grouping
+func snapshotWorkloadNames(sample SnapshotSample) []string {
+	if len(sample.WorkloadNames) == 0 {
+		return []string{noGroup}
+	}
+	return sample.WorkloadNames
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func printSnapshotDiff(writer io.Writer, diff SnapshotDiff) error {
+	fmt.Fprintf(
+		writer,
+		"from %s to %s\n\n",
+		diff.Before.Time.Local().Format(time.RFC3339),
+		diff.After.Time.Local().Format(time.RFC3339),
+	)
+	sections := []struct {
+		what    string
+		samples []SnapshotSample
+	}{
+		{"created", diff.Created},
+		{"destroyed", diff.Destroyed},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(writer, "%d containers %s\n", len(section.samples), section.what)
+		if len(section.samples) > 0 {
+			err := printSnapshotSampleTable(writer, section.samples)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintln(writer)
+	}
+	data := []ui.TableRow{}
+	for _, delta := range diff.Workloads {
+		change := ui.TableCell{Contents: "+" + humanReadable(uint64(delta.change()))}
+		if delta.change() < 0 {
+			change = ui.TableCell{
+				Contents: "-" + humanReadable(uint64(-delta.change())),
+				Color:    color.New(color.FgGreen),
+			}
+		} else {
+			change.Color = color.New(color.FgRed)
+		}
+		data = append(data, ui.TableRow{
+			ui.TableCell{Contents: delta.Workload},
+			ui.TableCell{Contents: humanReadable(delta.Before)},
+			ui.TableCell{Contents: humanReadable(delta.After)},
+			change,
+		})
+	}
+	table := ui.Table{
+		Headers: ui.TableRow{
+			ui.TableCell{
+				Contents: "workload",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "before",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "after",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "change",
+				Color:    color.New(color.Bold),
+			},
+		},
+		Data: data,
+	}
+	return table.Render(writer, true)
+}
+
+func printSnapshotSampleTable(writer io.Writer, samples []SnapshotSample) error {
+	data := []ui.TableRow{}
+	for _, sample := range samples {
+		data = append(data, ui.TableRow{
+			ui.TableCell{Contents: strings.Join(sample.WorkloadNames, ",")},
+			ui.TableCell{Contents: sample.Type},
+			ui.TableCell{Contents: humanReadable(sample.MemoryBytes)},
+			ui.TableCell{Contents: sample.Handle},
+		})
+	}
+	table := ui.Table{
+		Headers: ui.TableRow{
+			ui.TableCell{
+				Contents: "workloads",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "type",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "memory",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "handle",
+				Color:    color.New(color.Bold),
+			},
+		},
+		Data: data,
+	}
+	return table.Render(writer, true)
+}
+
+// record appends a snapshot of the worker's accounts to the store, and keeps
+// doing so every interval if one is given.
+func record(stdout io.Writer, cmd Command, worker Worker, accountant Accountant) int {
+	store := &SnapshotStore{Path: cmd.SnapshotPath}
+	for {
+		exitCode := recordSnapshot(stdout, cmd, store, worker, accountant)
+		if cmd.Interval == 0 {
+			return exitCode
+		}
+		time.Sleep(cmd.Interval)
+	}
+}
+
+func recordSnapshot(
+	stdout io.Writer,
+	cmd Command,
+	store *SnapshotStore,
+	worker Worker,
+	accountant Accountant,
+) int {
+	exitCode := 0
+	containers, err := worker.Containers(statsOptions(cmd)...)
+	if workerErrors, ok := err.(WorkerErrors); ok {
+		// the workers which did answer are still worth recording
+		for _, name := range workerErrors.Names() {
+			fmt.Fprintf(stdout, "worker error: %s: %s\n", name, workerErrors[name].Error())
+		}
+		exitCode = 1
+	} else if err != nil {
+		fmt.Fprintf(stdout, "worker error: %s\n", err.Error())
+		return 1
+	}
+	samples, err := accountant.Account(containers)
+	if err != nil {
+		fmt.Fprintf(stdout, "accountant error: %s\n", err.Error())
+		return 1
+	}
+	snapshot := NewSnapshot(time.Now(), samples)
+	err = store.Append(snapshot)
+	if err != nil {
+		fmt.Fprintf(stdout, "snapshot error: %s\n", err.Error())
+		return 1
+	}
+	fmt.Fprintf(
+		stdout,
+		"recorded %d containers at %s\n",
+		len(samples),
+		snapshot.Time.Local().Format(time.Stamp),
+	)
+	return exitCode
+}
+
+func diff(stdout io.Writer, cmd Command) int {
+	store := &SnapshotStore{Path: cmd.SnapshotPath}
+	before, err := store.At(cmd.Since)
+	if err != nil {
+		fmt.Fprintf(stdout, "snapshot error: %s\n", err.Error())
+		return 1
+	}
+	after, err := store.At(cmd.Until)
+	if err != nil {
+		fmt.Fprintf(stdout, "snapshot error: %s\n", err.Error())
+		return 1
+	}
+	err = printSnapshotDiff(stdout, DiffSnapshots(before, after))
+	if err != nil {
+		return 1
+	}
+	return 0
+}
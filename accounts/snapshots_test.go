@@ -0,0 +1,178 @@
+package accounts_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/concourse/ft/accounts"
+	"github.com/concourse/ft/accounts/accountsfakes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SnapshotSuite struct {
+	suite.Suite
+	*require.Assertions
+	dir   string
+	store *accounts.SnapshotStore
+}
+
+func (s *SnapshotSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "ft-snapshots")
+	s.NoError(err)
+	s.store = &accounts.SnapshotStore{Path: filepath.Join(s.dir, "snapshots.db")}
+}
+
+func (s *SnapshotSuite) TearDownTest() {
+	os.RemoveAll(s.dir)
+}
+
+func snapshotSample(handle, workload string, memory uint64) accounts.Sample {
+	return accounts.Sample{
+		Container: accounts.Container{
+			Handle: handle,
+			Stats:  accounts.Stats{Memory: memory},
+		},
+		Labels: accounts.Labels{
+			Workloads: []accounts.Workload{
+				testWorkload{accounts.WorkloadFields{Team: "main", Pipeline: workload}},
+			},
+		},
+	}
+}
+
+func (s *SnapshotSuite) TestFindsTheLastSnapshotAtOrBeforeATime() {
+	twoAM := time.Date(2020, 9, 1, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		s.NoError(s.store.Append(accounts.NewSnapshot(
+			twoAM.Add(time.Duration(i)*30*time.Minute),
+			make([]accounts.Sample, i),
+		)))
+	}
+
+	exact, err := s.store.At(twoAM.Add(30 * time.Minute))
+	s.NoError(err)
+	between, err := s.store.At(twoAM.Add(50 * time.Minute))
+	s.NoError(err)
+	_, err = s.store.At(twoAM.Add(-time.Minute))
+
+	s.Len(exact.Samples, 1)
+	s.Len(between.Samples, 1)
+	s.EqualError(err, "no snapshot at or before 2020-09-01T01:59:00Z")
+}
+
+func (s *SnapshotSuite) TestListsSnapshotsBetweenTimes() {
+	twoAM := time.Date(2020, 9, 1, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		s.NoError(s.store.Append(accounts.NewSnapshot(
+			twoAM.Add(time.Duration(i)*time.Hour),
+			nil,
+		)))
+	}
+
+	snapshots, err := s.store.Between(twoAM.Add(time.Hour), twoAM.Add(2*time.Hour))
+
+	s.NoError(err)
+	s.Len(snapshots, 2)
+	s.Equal(twoAM.Add(time.Hour), snapshots[0].Time)
+}
+
+func (s *SnapshotSuite) TestFailsWithoutAStore() {
+	_, err := s.store.At(time.Now())
+
+	s.Error(err)
+	_, statErr := os.Stat(s.store.Path)
+	s.True(os.IsNotExist(statErr))
+}
+
+func (s *SnapshotSuite) TestDiffsContainersAndWorkloadMemory() {
+	before := accounts.NewSnapshot(time.Now(), []accounts.Sample{
+		snapshotSample("steady", "p", 100),
+		snapshotSample("leaving", "q", 300),
+	})
+	after := accounts.NewSnapshot(time.Now(), []accounts.Sample{
+		snapshotSample("steady", "p", 150),
+		snapshotSample("arriving", "r", 1000),
+	})
+
+	diff := accounts.DiffSnapshots(before, after)
+
+	s.Len(diff.Created, 1)
+	s.Equal("arriving", diff.Created[0].Handle)
+	s.Len(diff.Destroyed, 1)
+	s.Equal("leaving", diff.Destroyed[0].Handle)
+	s.Equal([]accounts.WorkloadDelta{
+		{Workload: "main/r", Before: 0, After: 1000},
+		{Workload: "main/q", Before: 300, After: 0},
+		{Workload: "main/p", Before: 100, After: 150},
+	}, diff.Workloads)
+}
+
+func (s *SnapshotSuite) TestParsesTimesOfDay() {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	t, err := accounts.ParseSnapshotTime("02:00", now)
+
+	s.NoError(err)
+	s.Equal(time.Date(2020, 9, 1, 2, 0, 0, 0, time.UTC), t)
+}
+
+func (s *SnapshotSuite) TestRejectsUnknownTimes() {
+	_, err := accounts.ParseSnapshotTime("2am", time.Now())
+
+	s.EqualError(err, "invalid time '2am', must be RFC3339, 'YYYY-MM-DD HH:MM' or 'HH:MM'")
+}
+
+func (s *SnapshotSuite) TestRecordsAndDiffsSnapshots() {
+	fakeWorker := new(accountsfakes.FakeWorker)
+	fakeAccountant := new(accountsfakes.FakeAccountant)
+	fakeAccountant.AccountReturnsOnCall(0, []accounts.Sample{snapshotSample("old", "p", 1024)}, nil)
+	fakeAccountant.AccountReturnsOnCall(1, []accounts.Sample{snapshotSample("new", "p", 3072)}, nil)
+	execute := func(args ...string) (int, string) {
+		buf := bytes.NewBuffer([]byte{})
+		returnCode := accounts.Execute(
+			func(accounts.Command) (accounts.Worker, error) {
+				return fakeWorker, nil
+			}, func(accounts.Command) (accounts.Accountant, error) {
+				return fakeAccountant, nil
+			},
+			noopValidator,
+			args,
+			buf,
+		)
+		return returnCode, buf.String()
+	}
+
+	returnCode, output := execute("record", "--out", s.store.Path)
+	s.Equal(0, returnCode)
+	s.Contains(output, "recorded 1 containers at")
+	since := time.Now()
+	time.Sleep(time.Millisecond)
+	returnCode, _ = execute("record", "--out", s.store.Path)
+	s.Equal(0, returnCode)
+
+	returnCode, output = execute(
+		"diff",
+		"--in", s.store.Path,
+		since.Format(time.RFC3339Nano),
+		time.Now().Format(time.RFC3339Nano),
+	)
+
+	s.Equal(0, returnCode)
+	s.Contains(output, "1 containers created")
+	s.Contains(output, "1 containers destroyed")
+	s.Regexp(`main/p\s+1024 B\s+3.0 KB\s+\+2.0 KB`, output)
+}
+
+func (s *SnapshotSuite) TestDiffNeedsTwoTimes() {
+	buf := bytes.NewBuffer([]byte{})
+
+	returnCode := accounts.Execute(nil, nil, noopValidator, []string{"diff", "02:00"}, buf)
+
+	s.Equal(1, returnCode)
+	s.Contains(buf.String(), "diff needs the times to compare")
+}
@@ -0,0 +1,229 @@
+package accounts
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// an SSHHop is a host to sign in to on the way to somewhere else, i.e. a
+// jumpbox in front of a private network.
+type SSHHop struct {
+	Addr   string
+	Config *ssh.ClientConfig
+}
+
+// NewHostKeyCallback checks host keys against the known_hosts file at path,
+// ~/.ssh/known_hosts when it is empty. Worker VMs come and go too often to be
+// in anyone's known_hosts, so checking can be skipped, but only when insecure
+// is asked for.
+func NewHostKeyCallback(path string, insecure bool) (ssh.HostKeyCallback, error) {
+	if insecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	return knownhosts.New(path)
+}
+
+// NewSSHClientConfig signs in as user with the private key at keyPath,
+// checking host keys with hostKeys.
+func NewSSHClientConfig(user, keyPath string, hostKeys ssh.HostKeyCallback) (*ssh.ClientConfig, error) {
+	pem, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+	}, nil
+}
+
+// NewSSHAgentClientConfig signs in as user with whichever keys the ssh-agent
+// listening on socket holds, checking host keys with hostKeys. The agent is
+// only connected to while keys are listed and used, so nothing is left open
+// between sign ins.
+func NewSSHAgentClientConfig(user, socket string, hostKeys ssh.HostKeyCallback) (*ssh.ClientConfig, error) {
+	// make sure there is an agent before anything signs in with it
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	return &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			return agentSigners(socket)
+		})},
+		HostKeyCallback: hostKeys,
+	}, nil
+}
+
+func agentSigners(socket string) ([]ssh.Signer, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, err
+	}
+	signers := []ssh.Signer{}
+	for _, key := range keys {
+		signers = append(signers, &agentSigner{socket: socket, key: key})
+	}
+	return signers, nil
+}
+
+// an agentSigner signs with a key in the ssh-agent listening on socket,
+// connecting to it for each signature.
+type agentSigner struct {
+	socket string
+	key    ssh.PublicKey
+}
+
+func (as *agentSigner) PublicKey() ssh.PublicKey {
+	return as.key
+}
+
+func (as *agentSigner) Sign(_ io.Reader, data []byte) (*ssh.Signature, error) {
+	conn, err := net.Dial("unix", as.socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return agent.NewClient(conn).Sign(as.key, data)
+}
+
+// sshAddr adds the default SSH port to hosts given without one.
+func sshAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return net.JoinHostPort(host, "22")
+	}
+	return host
+}
+
+// an SSHGardenDialer reaches the Garden of a worker on a remote host by
+// tunnelling to it over SSH. Its address is as seen from the host, defaulting
+// as LANGardenDialer's does.
+type SSHGardenDialer struct {
+	Hop        SSHHop
+	GardenAddr string
+
+	tunnels sshTunnels
+}
+
+func (sgd *SSHGardenDialer) Dial() (net.Conn, error) {
+	network, addr := gardenNetworkAddr(sgd.GardenAddr)
+	return sgd.tunnels.Dial([]SSHHop{sgd.Hop}, network, addr)
+}
+
+// sshConnect signs in to each hop in turn, reaching every hop through the one
+// before it. The last client is signed in to the last hop.
+func sshConnect(hops []SSHHop) ([]*ssh.Client, error) {
+	clients := []*ssh.Client{}
+	for _, hop := range hops {
+		var (
+			conn net.Conn
+			err  error
+		)
+		if len(clients) == 0 {
+			conn, err = net.Dial("tcp", hop.Addr)
+		} else {
+			conn, err = clients[len(clients)-1].Dial("tcp", hop.Addr)
+		}
+		if err != nil {
+			closeSSHClients(clients)
+			return nil, err
+		}
+		sshConn, chans, reqs, err := ssh.NewClientConn(conn, hop.Addr, hop.Config)
+		if err != nil {
+			conn.Close()
+			closeSSHClients(clients)
+			return nil, err
+		}
+		clients = append(clients, ssh.NewClient(sshConn, chans, reqs))
+	}
+	return clients, nil
+}
+
+// sshTunnels dials through a chain of hops, signing in to them once and
+// opening a channel on the same connection for each tunnel. Once the
+// connection is lost, the next tunnel signs in again.
+type sshTunnels struct {
+	lock    sync.Mutex
+	clients []*ssh.Client
+}
+
+// Dial dials addr from the last of the hops, as a direct-tcpip channel, or a
+// direct-streamlocal one for unix sockets.
+func (st *sshTunnels) Dial(hops []SSHHop, network, addr string) (net.Conn, error) {
+	client, err := st.client(hops)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, addr)
+	if _, rejected := err.(*ssh.OpenChannelError); err == nil || rejected {
+		return conn, err
+	}
+	// the connection may have been lost since it was last used
+	st.forget(client)
+	client, err = st.client(hops)
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial(network, addr)
+}
+
+// client is signed in to the last of the hops.
+func (st *sshTunnels) client(hops []SSHHop) (*ssh.Client, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.clients == nil {
+		clients, err := sshConnect(hops)
+		if err != nil {
+			return nil, err
+		}
+		st.clients = clients
+		go func() {
+			clients[len(clients)-1].Wait()
+			st.forget(clients[len(clients)-1])
+		}()
+	}
+	return st.clients[len(st.clients)-1], nil
+}
+
+// forget signs out of every hop, if client is still the current one.
+func (st *sshTunnels) forget(client *ssh.Client) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if len(st.clients) == 0 || st.clients[len(st.clients)-1] != client {
+		return
+	}
+	closeSSHClients(st.clients)
+	st.clients = nil
+}
+
+func closeSSHClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
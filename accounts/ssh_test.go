@@ -0,0 +1,428 @@
+package accounts_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/garden/gardenfakes"
+	"code.cloudfoundry.org/garden/server"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type SSHGardenDialerSuite struct {
+	suite.Suite
+	*require.Assertions
+	keyPath      string
+	sshServer    *testSSHServer
+	hostKeys     ssh.HostKeyCallback
+	knownHosts   string
+	backend      *gardenfakes.FakeBackend
+	gardenServer *server.GardenServer
+}
+
+func (s *SSHGardenDialerSuite) SetupTest() {
+	var publicKey ssh.PublicKey
+	var err error
+	s.keyPath, publicKey, err = testSSHKey()
+	s.NoError(err)
+	s.sshServer, err = newTestSSHServer(publicKey)
+	s.NoError(err)
+	s.knownHosts, err = testKnownHosts(map[string]ssh.PublicKey{
+		s.sshServer.Addr(): s.sshServer.hostKey,
+	})
+	s.NoError(err)
+	s.hostKeys, err = accounts.NewHostKeyCallback(s.knownHosts, false)
+	s.NoError(err)
+	s.backend = new(gardenfakes.FakeBackend)
+	s.backend.ContainersReturns([]garden.Container{}, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	s.gardenServer = server.New(
+		"tcp",
+		listener.Addr().String(),
+		0,
+		s.backend,
+		lagertest.NewTestLogger("test"),
+	)
+	go s.gardenServer.Serve(listener)
+	s.sshServer.routes["127.0.0.1:7777"] = listener.Addr().String()
+}
+
+func (s *SSHGardenDialerSuite) TearDownTest() {
+	s.gardenServer.Stop()
+	s.sshServer.Close()
+	os.Remove(s.keyPath)
+	os.Remove(s.knownHosts)
+}
+
+func (s *SSHGardenDialerSuite) TestReachesGardenWithAKey() {
+	config, err := accounts.NewSSHClientConfig("root", s.keyPath, s.hostKeys)
+	s.NoError(err)
+	worker := &accounts.GardenWorker{
+		Dialer: &accounts.SSHGardenDialer{
+			Hop: accounts.SSHHop{Addr: s.sshServer.Addr(), Config: config},
+		},
+	}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, s.backend.ContainersCallCount())
+}
+
+func (s *SSHGardenDialerSuite) TestReachesGardenWithAnAgent() {
+	pemBytes, err := ioutil.ReadFile(s.keyPath)
+	s.NoError(err)
+	key, err := ssh.ParseRawPrivateKey(pemBytes)
+	s.NoError(err)
+	keyring := agent.NewKeyring()
+	s.NoError(keyring.Add(agent.AddedKey{PrivateKey: key}))
+	dir, err := ioutil.TempDir("", "ft-ssh-agent")
+	s.NoError(err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	s.NoError(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	config, err := accounts.NewSSHAgentClientConfig("root", socket, s.hostKeys)
+	s.NoError(err)
+	worker := &accounts.GardenWorker{
+		Dialer: &accounts.SSHGardenDialer{
+			Hop: accounts.SSHHop{Addr: s.sshServer.Addr(), Config: config},
+		},
+	}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, s.backend.ContainersCallCount())
+}
+
+func (s *SSHGardenDialerSuite) TestReachesGardenAtTheGivenAddr() {
+	s.sshServer.routes["10.0.0.7:7000"] = s.sshServer.routes["127.0.0.1:7777"]
+	delete(s.sshServer.routes, "127.0.0.1:7777")
+	config, err := accounts.NewSSHClientConfig("root", s.keyPath, s.hostKeys)
+	s.NoError(err)
+	dialer := &accounts.SSHGardenDialer{
+		Hop:        accounts.SSHHop{Addr: s.sshServer.Addr(), Config: config},
+		GardenAddr: "10.0.0.7:7000",
+	}
+	worker := &accounts.GardenWorker{Dialer: dialer}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, s.backend.ContainersCallCount())
+}
+
+func (s *SSHGardenDialerSuite) TestReusesItsConnection() {
+	config, err := accounts.NewSSHClientConfig("root", s.keyPath, s.hostKeys)
+	s.NoError(err)
+	worker := &accounts.GardenWorker{
+		Dialer: &accounts.SSHGardenDialer{
+			Hop: accounts.SSHHop{Addr: s.sshServer.Addr(), Config: config},
+		},
+	}
+
+	_, err = worker.Containers()
+	s.NoError(err)
+	_, err = worker.Containers()
+	s.NoError(err)
+
+	s.Equal(2, s.backend.ContainersCallCount())
+	s.Equal(1, s.sshServer.SignIns())
+	// a lost connection is signed in to again
+	s.sshServer.Disconnect()
+	_, err = worker.Containers()
+	s.NoError(err)
+	s.Equal(2, s.sshServer.SignIns())
+}
+
+func (s *SSHGardenDialerSuite) TestFailsWithAnUnknownKey() {
+	otherKeyPath, _, err := testSSHKey()
+	s.NoError(err)
+	defer os.Remove(otherKeyPath)
+	config, err := accounts.NewSSHClientConfig("root", otherKeyPath, s.hostKeys)
+	s.NoError(err)
+	dialer := &accounts.SSHGardenDialer{
+		Hop: accounts.SSHHop{Addr: s.sshServer.Addr(), Config: config},
+	}
+
+	_, err = dialer.Dial()
+
+	s.Error(err)
+}
+
+func (s *SSHGardenDialerSuite) TestRejectsAnUnknownHostKey() {
+	knownHosts, err := testKnownHosts(map[string]ssh.PublicKey{})
+	s.NoError(err)
+	defer os.Remove(knownHosts)
+	hostKeys, err := accounts.NewHostKeyCallback(knownHosts, false)
+	s.NoError(err)
+	config, err := accounts.NewSSHClientConfig("root", s.keyPath, hostKeys)
+	s.NoError(err)
+	dialer := &accounts.SSHGardenDialer{
+		Hop: accounts.SSHHop{Addr: s.sshServer.Addr(), Config: config},
+	}
+
+	_, err = dialer.Dial()
+
+	s.Error(err)
+	s.Equal(0, s.backend.ContainersCallCount())
+}
+
+func (s *SSHGardenDialerSuite) TestSkipsHostKeyChecksOnlyWhenInsecure() {
+	hostKeys, err := accounts.NewHostKeyCallback(
+		filepath.Join(os.TempDir(), "ft-no-such-known-hosts"),
+		true,
+	)
+	s.NoError(err)
+	config, err := accounts.NewSSHClientConfig("root", s.keyPath, hostKeys)
+	s.NoError(err)
+	worker := &accounts.GardenWorker{
+		Dialer: &accounts.SSHGardenDialer{
+			Hop: accounts.SSHHop{Addr: s.sshServer.Addr(), Config: config},
+		},
+	}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+}
+
+// testKnownHosts writes a known_hosts file with the host key of each address
+// and returns its path.
+func testKnownHosts(hosts map[string]ssh.PublicKey) (string, error) {
+	file, err := ioutil.TempFile("", "ft-known-hosts")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	for addr, key := range hosts {
+		_, err := file.WriteString(knownhosts.Line([]string{addr}, key) + "\n")
+		if err != nil {
+			os.Remove(file.Name())
+			return "", err
+		}
+	}
+	return file.Name(), nil
+}
+
+// testSSHKey writes a fresh private key to a temporary file and returns its
+// path along with the matching public key.
+func testSSHKey() (string, ssh.PublicKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	file, err := ioutil.TempFile("", "ft-ssh-key")
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	err = pem.Encode(file, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err != nil {
+		os.Remove(file.Name())
+		return "", nil, err
+	}
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", nil, err
+	}
+	return file.Name(), publicKey, nil
+}
+
+// a testSSHServer lets in the holder of one key. It forwards direct-tcpip
+// channels, sending any destination in routes somewhere else, and answers
+// commands in sessions with the output it is given.
+type testSSHServer struct {
+	listener net.Listener
+	hostKey  ssh.PublicKey
+	routes   map[string]string
+	commands map[string]string
+
+	lock  sync.Mutex
+	conns []net.Conn
+}
+
+func newTestSSHServer(authorized ssh.PublicKey) (*testSSHServer, error) {
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &testSSHServer{
+		listener: listener,
+		hostKey:  hostSigner.PublicKey(),
+		routes:   map[string]string{},
+		commands: map[string]string{},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+	return server, nil
+}
+
+func (tss *testSSHServer) Addr() string {
+	return tss.listener.Addr().String()
+}
+
+func (tss *testSSHServer) Close() {
+	tss.listener.Close()
+}
+
+// SignIns is how many clients have signed in.
+func (tss *testSSHServer) SignIns() int {
+	tss.lock.Lock()
+	defer tss.lock.Unlock()
+	return len(tss.conns)
+}
+
+// Disconnect drops every client that has signed in.
+func (tss *testSSHServer) Disconnect() {
+	tss.lock.Lock()
+	defer tss.lock.Unlock()
+	for _, conn := range tss.conns {
+		conn.Close()
+	}
+}
+
+func (tss *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	tss.lock.Lock()
+	tss.conns = append(tss.conns, conn)
+	tss.lock.Unlock()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "direct-tcpip":
+			go tss.forward(newChannel)
+		case "session":
+			go tss.session(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+		}
+	}
+}
+
+func (tss *testSSHServer) forward(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	err := ssh.Unmarshal(newChannel.ExtraData(), &payload)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+	if route, ok := tss.routes[addr]; ok {
+		addr = route
+	}
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		io.Copy(target, channel)
+		target.Close()
+	}()
+	io.Copy(channel, target)
+	channel.Close()
+}
+
+func (tss *testSSHServer) session(newChannel ssh.NewChannel) {
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		ssh.Unmarshal(req.Payload, &payload)
+		output, ok := tss.commands[payload.Command]
+		req.Reply(true, nil)
+		status := uint32(0)
+		if ok {
+			channel.Write([]byte(output))
+		} else {
+			status = 127
+		}
+		channel.SendRequest(
+			"exit-status",
+			false,
+			ssh.Marshal(struct{ Status uint32 }{status}),
+		)
+		return
+	}
+}
@@ -0,0 +1,162 @@
+package accounts
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/concourse/concourse/fly/ui"
+	"github.com/fatih/color"
+)
+
+// clears a terminal and moves the cursor back to the top left, so that each
+// frame is drawn over the last.
+const clearScreen = "\033[H\033[2J"
+
+// a Top re-accounts a worker's containers on every tick and draws them along
+// with what changed since the tick before: containers which are new, which
+// have gone away and whose memory grew.
+type Top struct {
+	Worker       Worker
+	Accountant   Accountant
+	StatsOptions []StatsOption
+	SortBy       string
+	Reverse      bool
+
+	previous map[string]Sample
+}
+
+// Tick accounts for the worker's containers and draws a frame to writer.
+func (t *Top) Tick(writer io.Writer, now time.Time) error {
+	containers, err := t.Worker.Containers(t.StatsOptions...)
+	workerErrors, partial := err.(WorkerErrors)
+	if err != nil && !partial {
+		return fmt.Errorf("worker error: %s", err.Error())
+	}
+	samples, err := t.Accountant.Account(containers)
+	if err != nil {
+		return fmt.Errorf("accountant error: %s", err.Error())
+	}
+	SortSamples(samples, t.SortBy, t.Reverse)
+
+	if _, isTTY := ui.ForTTY(writer); isTTY {
+		fmt.Fprint(writer, clearScreen)
+	} else if t.previous != nil {
+		fmt.Fprintln(writer)
+	}
+	fmt.Fprintf(writer, "%d containers at %s\n", len(samples), now.Format(time.Stamp))
+	if partial {
+		for _, name := range workerErrors.Names() {
+			fmt.Fprintf(writer, "worker error: %s: %s\n", name, workerErrors[name].Error())
+		}
+	}
+	err = t.render(writer, samples)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]Sample{}
+	for _, sample := range samples {
+		current[sample.Container.Handle] = sample
+	}
+	t.previous = current
+	return nil
+}
+
+func (t *Top) render(writer io.Writer, samples []Sample) error {
+	data := []ui.TableRow{}
+	seen := map[string]bool{}
+	for _, sample := range samples {
+		handle := sample.Container.Handle
+		seen[handle] = true
+		memory := ui.TableCell{Contents: humanReadable(sample.Container.Stats.Memory)}
+		change := ui.TableCell{}
+		if previous, ok := t.previous[handle]; !ok && t.previous != nil {
+			change = ui.TableCell{Contents: "new", Color: color.New(color.FgGreen)}
+		} else if ok && sample.Container.Stats.Memory > previous.Container.Stats.Memory {
+			growth := sample.Container.Stats.Memory - previous.Container.Stats.Memory
+			change = ui.TableCell{Contents: "+" + humanReadable(growth)}
+			memory.Color = color.New(color.FgRed)
+		}
+		data = append(data, topRow(sample, memory, change))
+	}
+	// containers which went away since the last tick get one last row, so
+	// they don't silently drop out of view
+	gone := []Sample{}
+	for handle, sample := range t.previous {
+		if !seen[handle] {
+			gone = append(gone, sample)
+		}
+	}
+	SortSamples(gone, "handle", false)
+	for _, sample := range gone {
+		data = append(data, topRow(
+			sample,
+			ui.TableCell{Contents: humanReadable(sample.Container.Stats.Memory)},
+			ui.TableCell{Contents: "gone", Color: color.New(color.Faint)},
+		))
+	}
+	table := ui.Table{
+		Headers: ui.TableRow{
+			ui.TableCell{
+				Contents: "workloads",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "type",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "memory",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "change",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "cpu",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "age",
+				Color:    color.New(color.Bold),
+			},
+			ui.TableCell{
+				Contents: "handle",
+				Color:    color.New(color.Bold),
+			},
+		},
+		Data: data,
+	}
+	return table.Render(writer, true)
+}
+
+func topRow(sample Sample, memory, change ui.TableCell) ui.TableRow {
+	return ui.TableRow{
+		ui.TableCell{Contents: workloadString(sample)},
+		ui.TableCell{Contents: string(sample.Labels.Type)},
+		memory,
+		change,
+		ui.TableCell{Contents: cpuPercent(sample.Container.Stats)},
+		ui.TableCell{Contents: sample.Container.Stats.Age.String()},
+		ui.TableCell{Contents: sample.Container.Handle},
+	}
+}
+
+func top(stdout io.Writer, cmd Command, worker Worker, accountant Accountant) int {
+	t := &Top{
+		Worker:       worker,
+		Accountant:   accountant,
+		StatsOptions: statsOptions(cmd),
+		SortBy:       cmd.SortBy,
+		Reverse:      cmd.Reverse,
+	}
+	for {
+		err := t.Tick(stdout, time.Now())
+		if err != nil {
+			fmt.Fprintln(stdout, err.Error())
+		}
+		time.Sleep(cmd.Interval)
+	}
+}
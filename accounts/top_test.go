@@ -0,0 +1,101 @@
+package accounts_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/concourse/ft/accounts"
+	"github.com/concourse/ft/accounts/accountsfakes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TopSuite struct {
+	suite.Suite
+	*require.Assertions
+	worker     *accountsfakes.FakeWorker
+	accountant *accountsfakes.FakeAccountant
+	top        *accounts.Top
+}
+
+func (s *TopSuite) SetupTest() {
+	s.worker = new(accountsfakes.FakeWorker)
+	s.accountant = new(accountsfakes.FakeAccountant)
+	s.top = &accounts.Top{
+		Worker:     s.worker,
+		Accountant: s.accountant,
+		SortBy:     "memory",
+	}
+}
+
+func topSample(handle string, memory uint64) accounts.Sample {
+	return accounts.Sample{
+		Container: accounts.Container{
+			Handle: handle,
+			Stats:  accounts.Stats{Memory: memory, CPUMeasured: true},
+		},
+	}
+}
+
+func (s *TopSuite) TestMarksNothingOnTheFirstTick() {
+	s.accountant.AccountReturns([]accounts.Sample{topSample("abc123", 1024)}, nil)
+	buf := bytes.NewBuffer([]byte{})
+
+	err := s.top.Tick(buf, time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC))
+
+	s.NoError(err)
+	s.Contains(buf.String(), "1 containers at Sep  1 12:00:00\n")
+	s.Regexp(`1024 B\s+0.0%`, buf.String())
+	s.NotContains(buf.String(), "new")
+}
+
+func (s *TopSuite) TestMarksNewGoneAndGrowingContainers() {
+	s.accountant.AccountReturnsOnCall(0, []accounts.Sample{
+		topSample("growing", 1024),
+		topSample("steady", 2048),
+		topSample("leaving", 4096),
+	}, nil)
+	s.accountant.AccountReturnsOnCall(1, []accounts.Sample{
+		topSample("growing", 3072),
+		topSample("steady", 2048),
+		topSample("arriving", 512),
+	}, nil)
+	s.NoError(s.top.Tick(bytes.NewBuffer([]byte{}), time.Now()))
+	buf := bytes.NewBuffer([]byte{})
+
+	err := s.top.Tick(buf, time.Now())
+
+	s.NoError(err)
+	s.Regexp(`3.0 KB\s+\+2.0 KB\s+0.0%\s+0s\s+growing`, buf.String())
+	s.Regexp(`2.0 KB\s+0.0%\s+0s\s+steady`, buf.String())
+	s.Regexp(`512 B\s+new\s+0.0%\s+0s\s+arriving`, buf.String())
+	s.Regexp(`4.0 KB\s+gone\s+0.0%\s+0s\s+leaving`, buf.String())
+	s.Less(
+		bytes.Index(buf.Bytes(), []byte("growing")),
+		bytes.Index(buf.Bytes(), []byte("leaving")),
+	)
+}
+
+func (s *TopSuite) TestKeepsDrawingWhenSomeWorkersFail() {
+	s.worker.ContainersReturns(
+		[]accounts.Container{{Handle: "abc123"}},
+		accounts.WorkerErrors{"worker-2": errors.New("connection refused")},
+	)
+	s.accountant.AccountReturns([]accounts.Sample{topSample("abc123", 1024)}, nil)
+	buf := bytes.NewBuffer([]byte{})
+
+	err := s.top.Tick(buf, time.Now())
+
+	s.NoError(err)
+	s.Contains(buf.String(), "worker error: worker-2: connection refused\n")
+	s.Contains(buf.String(), "abc123")
+}
+
+func (s *TopSuite) TestReportsAccountantErrors() {
+	s.accountant.AccountReturns(nil, errors.New("db down"))
+
+	err := s.top.Tick(bytes.NewBuffer([]byte{}), time.Now())
+
+	s.EqualError(err, "accountant error: db down")
+}
@@ -1,6 +1,13 @@
 package accounts
 
-import "github.com/concourse/flag"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/concourse/flag"
+)
 
 var DefaultValidator = func(cmd Command) error {
 	err := validateFileFlag(cmd.Postgres.CACert.Path())
@@ -15,6 +22,124 @@ var DefaultValidator = func(cmd Command) error {
 	if err != nil {
 		return err
 	}
+	err = validateChoice("group-by", cmd.GroupBy, GroupByChoices)
+	if err != nil {
+		return err
+	}
+	if cmd.SplitShared && cmd.GroupBy == "" {
+		return errors.New("--split-shared needs --group-by")
+	}
+	err = validateChoice("output", cmd.Output, OutputChoices)
+	if err != nil {
+		return err
+	}
+	err = validateChoice("sort", cmd.SortBy, SortChoices)
+	if err != nil {
+		return err
+	}
+	for _, t := range cmd.Types {
+		err = validateChoice("type", t, TypeChoices)
+		if err != nil {
+			return err
+		}
+	}
+	if (cmd.BoshInstance != "" || cmd.BoshWebInstance != "") &&
+		(cmd.BoshDeployment == "" || cmd.BoshGatewayHost == "" || cmd.BoshGatewayKey == "") {
+		return errors.New("BOSH instances need --bosh-deployment, --bosh-gateway-host and --bosh-gateway-key")
+	}
+	err = validateFileFlag(cmd.BoshGatewayKey)
+	if err != nil {
+		return err
+	}
+	err = validateFileFlag(cmd.BoshKey)
+	if err != nil {
+		return err
+	}
+	err = validateFileFlag(cmd.SSHKey)
+	if err != nil {
+		return err
+	}
+	if cmd.SSHHost != "" && cmd.SSHKey == "" && os.Getenv("SSH_AUTH_SOCK") == "" {
+		return errors.New("--ssh-host needs --ssh-key or an ssh-agent at $SSH_AUTH_SOCK")
+	}
+	webNodes := 0
+	for _, given := range []bool{
+		cmd.BoshWebInstance != "",
+		cmd.WebK8sPod != "",
+		cmd.WebK8sDeployment != "",
+		cmd.HelmRelease != "",
+		cmd.WebDockerContainer != "",
+		cmd.WebEnvFile != "",
+		cmd.WebPID != 0,
+	} {
+		if given {
+			webNodes++
+		}
+	}
+	if webNodes > 1 {
+		return errors.New("--bosh-web-instance, --web-k8s-pod, --web-k8s-deployment, --helm-release, --web-docker-container, --web-env-file and --web-pid cannot be combined")
+	}
+	if cmd.WebK8sDeployment != "" {
+		_, err = ParseK8sWebWorkload(cmd.WebK8sDeployment)
+		if err != nil {
+			return fmt.Errorf("--web-k8s-deployment: %s", err.Error())
+		}
+	}
+	err = validateFileFlag(cmd.WebEnvFile)
+	if err != nil {
+		return err
+	}
+	if cmd.AllWorkers && cmd.K8sPod != "" {
+		return errors.New("--all-workers cannot be combined with --k8s-pod")
+	}
+	if cmd.K8sSelector != "" && (cmd.K8sPod != "" || cmd.AllWorkers) {
+		return errors.New("--k8s-selector cannot be combined with --k8s-pod or --all-workers")
+	}
+	if cmd.BoshInstance != "" && (cmd.K8sPod != "" || cmd.K8sSelector != "" || cmd.AllWorkers) {
+		return errors.New("--bosh-instance cannot be combined with --k8s-pod, --k8s-selector or --all-workers")
+	}
+	if cmd.SSHHost != "" &&
+		(cmd.BoshInstance != "" || cmd.K8sPod != "" || cmd.K8sSelector != "" || cmd.AllWorkers) {
+		return errors.New("--ssh-host cannot be combined with --bosh-instance, --k8s-pod, --k8s-selector or --all-workers")
+	}
+	if cmd.WorkerName != "" &&
+		(cmd.AllWorkers || cmd.K8sPod != "" || cmd.K8sSelector != "" || cmd.BoshInstance != "" || cmd.SSHHost != "") {
+		return errors.New("--worker-name cannot be combined with other ways of choosing a worker")
+	}
+	if cmd.K8sSelector != "" && cmd.K8sNamespace == "" {
+		return errors.New("--k8s-selector needs --k8s-namespace")
+	}
+	if cmd.Subcommand == "missing" && cmd.Disk {
+		return errors.New("--disk is not supported with missing, there is nothing to measure")
+	}
+	// filtered out containers would look like they had gone missing
+	if cmd.Subcommand == "missing" && (cmd.MinMemory > 0 || cmd.OlderThan > 0) {
+		return errors.New("--min-memory and --older-than are not supported with missing")
+	}
+	// pools label containers with their workers, single workers don't
+	if cmd.Subcommand == "missing" && cmd.MissingWorker == "" && cmd.WorkerName == "" &&
+		!cmd.AllWorkers && cmd.K8sSelector == "" {
+		return errors.New("missing needs --worker or --worker-name to know which worker the containers are from")
+	}
+	// volumes are sized through a single worker's garden
+	if cmd.AllWorkers && cmd.Disk {
+		return errors.New("--disk is not supported with --all-workers")
+	}
+	if cmd.K8sSelector != "" && cmd.Disk {
+		return errors.New("--disk is not supported with --k8s-selector")
+	}
+	if (cmd.Subcommand == "serve" || cmd.Subcommand == "top") && cmd.Interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if cmd.Subcommand == "record" && cmd.Interval < 0 {
+		return errors.New("--interval must not be negative")
+	}
+	if cmd.Subcommand == "jobs" && cmd.Builds <= 0 {
+		return errors.New("--builds must be positive")
+	}
+	if cmd.Subcommand == "diff" && !cmd.Since.Before(cmd.Until) {
+		return errors.New("diff's first time must be before its second")
+	}
 	return nil
 }
 
@@ -25,3 +150,20 @@ func validateFileFlag(path string) error {
 	var file flag.File
 	return file.UnmarshalFlag(path)
 }
+
+func validateChoice(flagName, value string, choices []string) error {
+	if value == "" {
+		return nil
+	}
+	for _, choice := range choices {
+		if value == choice {
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"invalid value '%s' for --%s, must be one of: %s",
+		value,
+		flagName,
+		strings.Join(choices, ", "),
+	)
+}
@@ -0,0 +1,211 @@
+package accounts
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/concourse/concourse/atc/db"
+)
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . VolumeSizer
+
+// a VolumeSizer measures how much disk the given volumes take up, by their
+// handles. Volumes it can't measure are left out of the result.
+type VolumeSizer interface {
+	VolumeSizes([]VolumeMount) (map[string]uint64, error)
+}
+
+// a VolumeMount is a volume and where it is mounted in a container.
+type VolumeMount struct {
+	Volume    string
+	Container string
+	Path      string
+	// CopyOnWrite volumes are made from another volume, whose contents they
+	// share until they are written to.
+	CopyOnWrite bool
+	// ContainerAge is how long ago the container was created.
+	ContainerAge time.Duration
+}
+
+// a VolumeAccountant adds the disk used by each container's volumes to the
+// samples produced by another Accountant.
+type VolumeAccountant struct {
+	Accountant Accountant
+	Opener     PostgresOpener
+	Volumes    VolumeSizer
+}
+
+func (va *VolumeAccountant) Account(containers []Container) ([]Sample, error) {
+	samples, err := va.Accountant.Account(containers)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := va.Opener.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	mounts, err := containerVolumes(conn, containers)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := va.Volumes.VolumeSizes(mounts)
+	if err != nil {
+		return nil, err
+	}
+	disk := map[string]uint64{}
+	unsized := map[string]bool{}
+	for _, mount := range mounts {
+		size, ok := sizes[mount.Volume]
+		if !ok {
+			// a partial sum would look like a real measurement
+			unsized[mount.Container] = true
+			continue
+		}
+		disk[mount.Container] += size
+	}
+	for i := range samples {
+		handle := samples[i].Container.Handle
+		if unsized[handle] {
+			continue
+		}
+		samples[i].Container.Stats.Disk = disk[handle]
+		samples[i].Container.Stats.DiskMeasured = true
+	}
+	return samples, nil
+}
+
+// containerVolumes finds the volumes mounted into the given containers.
+func containerVolumes(
+	conn *sql.DB,
+	containers []Container,
+) ([]VolumeMount, error) {
+	rows, err := sq.StatementBuilder.
+		PlaceholderFormat(sq.Dollar).
+		Select("v.handle", "c.handle", "v.path", "v.parent_id IS NOT NULL").
+		From("volumes v").
+		Join("containers c ON v.container_id = c.id").
+		Where(filterHandles(containers)).
+		RunWith(conn).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+
+	ages := map[string]time.Duration{}
+	for _, container := range containers {
+		ages[container.Handle] = container.Stats.Age
+	}
+	mounts := []VolumeMount{}
+	defer db.Close(rows)
+	for rows.Next() {
+		var (
+			mount VolumeMount
+			path  sql.NullString
+		)
+		err = rows.Scan(&mount.Volume, &mount.Container, &path, &mount.CopyOnWrite)
+		if err != nil {
+			return nil, err
+		}
+		// volumes without a path, i.e. a container's scratch volume, aren't
+		// mounted anywhere they can be measured from
+		if path.String == "" {
+			continue
+		}
+		mount.Path = path.String
+		mount.ContainerAge = ages[mount.Container]
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// GardenVolumes sizes volumes by running du in the containers they are
+// mounted into, so that their contents never leave the worker. Copy-on-write
+// volumes only count the files modified since their container was created,
+// rather than everything they share with the volume they were made from.
+// Volumes in containers that can't run the script, or without a find that
+// can compare modification times, are left out.
+type GardenVolumes struct {
+	Dialer GardenDialer
+}
+
+func (gv *GardenVolumes) VolumeSizes(mounts []VolumeMount) (map[string]uint64, error) {
+	byContainer := map[string][]VolumeMount{}
+	for _, mount := range mounts {
+		byContainer[mount.Container] = append(byContainer[mount.Container], mount)
+	}
+	connection := GardenConnection{Dialer: gv.Dialer}
+	sizes := map[string]uint64{}
+	for handle, containerMounts := range byContainer {
+		// containers without a shell can't be measured, which shouldn't stop
+		// the rest from being
+		stdout, err := connection.RunScript(handle, "sizing volumes", volumeSizesScript(containerMounts))
+		if err != nil {
+			continue
+		}
+		for volume, size := range parseVolumeSizes(stdout) {
+			sizes[volume] = size
+		}
+	}
+	return sizes, nil
+}
+
+// volumeSizesScript prints the handle of each volume and the kilobytes its
+// files take up, without leaving the filesystem it is on so that volumes
+// mounted within others aren't counted twice. A volume that couldn't be sized
+// is printed without a size.
+//
+// The creation time copy-on-write volumes are compared against is worked out
+// from the worker's own clock. Ages are rounded down, so that files written to
+// the parent volume just before the container was created are never counted.
+func volumeSizesScript(mounts []VolumeMount) string {
+	script := &strings.Builder{}
+	script.WriteString("now=$(date +%s)\n")
+	for _, mount := range mounts {
+		path := shellQuote(mount.Path)
+		if mount.CopyOnWrite {
+			created := fmt.Sprintf(
+				"@$((now - %d))",
+				int64(mount.ContainerAge/time.Second),
+			)
+			fmt.Fprintf(
+				script,
+				"echo %s $(find %s -maxdepth 0 -newermt %s >/dev/null 2>&1 && find %s -xdev -type f -newermt %s -exec du -k {} + 2>/dev/null | awk '{s+=$1} END {print s+0}')\n",
+				shellQuote(mount.Volume),
+				path,
+				created,
+				path,
+				created,
+			)
+		} else {
+			fmt.Fprintf(
+				script,
+				"echo %s $(du -skx %s 2>/dev/null | cut -f1)\n",
+				shellQuote(mount.Volume),
+				path,
+			)
+		}
+	}
+	return script.String()
+}
+
+func parseVolumeSizes(stdout string) map[string]uint64 {
+	sizes := map[string]uint64{}
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		kilobytes, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes[fields[0]] = kilobytes * 1024
+	}
+	return sizes
+}
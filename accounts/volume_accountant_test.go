@@ -0,0 +1,107 @@
+package accounts_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/garden/gardenfakes"
+	"code.cloudfoundry.org/garden/server"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/concourse/ft/accounts"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type VolumeAccountantSuite struct {
+	suite.Suite
+	*require.Assertions
+	gardenServer *server.GardenServer
+	backend      *gardenfakes.FakeBackend
+	listener     net.Listener
+}
+
+func (s *VolumeAccountantSuite) SetupTest() {
+	s.backend = new(gardenfakes.FakeBackend)
+	var err error
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	s.gardenServer = server.New(
+		"tcp",
+		s.listener.Addr().String(),
+		0,
+		s.backend,
+		lagertest.NewTestLogger("test"),
+	)
+	go s.gardenServer.Serve(s.listener)
+	s.NoError(s.gardenServer.SetupBomberman())
+}
+
+func (s *VolumeAccountantSuite) TearDownTest() {
+	s.gardenServer.Stop()
+	s.listener.Close()
+}
+
+func (s *VolumeAccountantSuite) TestSizesVolumesInTheirContainers() {
+	fakeContainer := new(gardenfakes.FakeContainer)
+	fakeContainer.RunStub = func(spec garden.ProcessSpec, pio garden.ProcessIO) (garden.Process, error) {
+		fakeProcess := new(gardenfakes.FakeProcess)
+		fakeProcess.WaitStub = func() (int, error) {
+			io.WriteString(pio.Stdout, "input-volume 12\nrootfs-volume 3\ncache-volume\n")
+			return 0, nil
+		}
+		return fakeProcess, nil
+	}
+	s.backend.LookupStub = func(handle string) (garden.Container, error) {
+		if handle == "no-shell" {
+			return nil, errors.New("unknown handle")
+		}
+		return fakeContainer, nil
+	}
+	volumes := &accounts.GardenVolumes{
+		Dialer: &accounts.LANGardenDialer{GardenAddr: s.listener.Addr().String()},
+	}
+
+	sizes, err := volumes.VolumeSizes([]accounts.VolumeMount{
+		{
+			Volume:    "input-volume",
+			Container: "task",
+			Path:      "/tmp/build/abc/input",
+		},
+		{
+			Volume:       "rootfs-volume",
+			Container:    "task",
+			Path:         "/",
+			CopyOnWrite:  true,
+			ContainerAge: 150 * time.Second,
+		},
+		{
+			Volume:    "cache-volume",
+			Container: "task",
+			Path:      "/tmp/build/abc/cache",
+		},
+		{
+			Volume:    "other-volume",
+			Container: "no-shell",
+			Path:      "/tmp/build/def/output",
+		},
+	})
+
+	s.NoError(err)
+	// volumes that couldn't be sized are left out, rather than counted as empty
+	s.Equal(map[string]uint64{
+		"input-volume":  12 * 1024,
+		"rootfs-volume": 3 * 1024,
+	}, sizes)
+	s.Equal(1, fakeContainer.RunCallCount())
+	spec, _ := fakeContainer.RunArgsForCall(0)
+	s.Equal("root", spec.User)
+	script := spec.Args[1]
+	// volume contents are measured in place, rather than streamed out
+	s.Contains(script, "du -skx '/tmp/build/abc/input'")
+	// copy-on-write volumes only count what changed since the container was
+	// created, not what they share with their parent
+	s.Contains(script, "find '/' -xdev -type f -newermt @$((now - 150))")
+}
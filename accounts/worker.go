@@ -1,8 +1,13 @@
 package accounts
 
 import (
+	"bytes"
+	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/garden"
@@ -26,13 +31,17 @@ type GardenConnection struct {
 	Dialer GardenDialer
 }
 
-func (gc GardenConnection) AllMetrics() (map[string]garden.ContainerMetricsEntry, error) {
-	connection := connection.NewWithDialerAndLogger(
+func (gc GardenConnection) conn() connection.Connection {
+	return connection.NewWithDialerAndLogger(
 		func(string, string) (net.Conn, error) {
 			return gc.Dialer.Dial()
 		},
 		lager.NewLogger("garden-connection"),
 	)
+}
+
+func (gc GardenConnection) AllMetrics() (map[string]garden.ContainerMetricsEntry, error) {
+	connection := gc.conn()
 	handles, err := connection.List(nil)
 	if err != nil {
 		return nil, err
@@ -40,47 +49,171 @@ func (gc GardenConnection) AllMetrics() (map[string]garden.ContainerMetricsEntry
 	return connection.BulkMetrics(handles)
 }
 
+// garden has no API for open files, so they are counted by running a shell
+// in the container. The count includes the shell's own few descriptors.
+const openFilesScript = `for fds in /proc/[0-9]*/fd; do ls "$fds"; done 2>/dev/null | wc -l`
+
+// OpenFiles counts the file descriptors held by every process in a container.
+func (gc GardenConnection) OpenFiles(handle string) (uint64, error) {
+	stdout, err := gc.RunScript(handle, "counting open files", openFilesScript)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(stdout), 10, 64)
+}
+
+// RunScript runs a shell script as root in a container and returns what it
+// printed. what describes the script for errors.
+func (gc GardenConnection) RunScript(handle, what, script string) (string, error) {
+	stdout := &bytes.Buffer{}
+	process, err := gc.conn().Run(
+		handle,
+		garden.ProcessSpec{
+			Path: "sh",
+			Args: []string{"-c", script},
+			User: "root",
+		},
+		garden.ProcessIO{Stdout: stdout},
+	)
+	if err != nil {
+		return "", err
+	}
+	exitStatus, err := process.Wait()
+	if err != nil {
+		return "", err
+	}
+	if exitStatus != 0 {
+		return "", fmt.Errorf("%s exited with %d", what, exitStatus)
+	}
+	return stdout.String(), nil
+}
+
 func (gw *GardenWorker) Containers(opts ...StatsOption) ([]Container, error) {
-	metricsEntries, err := GardenConnection{Dialer: gw.Dialer}.AllMetrics()
+	options := NewStatsOptions(opts...)
+	connection := GardenConnection{Dialer: gw.Dialer}
+	metricsEntries, err := connection.AllMetrics()
 	if err != nil {
 		return nil, err
 	}
+	var earlierEntries map[string]garden.ContainerMetricsEntry
+	if options.CPUInterval > 0 {
+		earlierEntries = metricsEntries
+		time.Sleep(options.CPUInterval)
+		metricsEntries, err = connection.AllMetrics()
+		if err != nil {
+			return nil, err
+		}
+	}
 	containers := []Container{}
 	for handle, metricsEntry := range metricsEntries {
 		memory := metricsEntry.Metrics.MemoryStat.TotalRss +
 			metricsEntry.Metrics.MemoryStat.TotalCache +
 			metricsEntry.Metrics.MemoryStat.TotalSwap
+		stats := Stats{
+			Memory:    memory,
+			Age:       metricsEntry.Metrics.Age,
+			CPUTime:   time.Duration(metricsEntry.Metrics.CPUStat.Usage),
+			Processes: metricsEntry.Metrics.PidStat.Current,
+		}
+		if earlierEntry, ok := earlierEntries[handle]; ok {
+			stats.CPUPercent = cpuUtilisation(
+				earlierEntry.Metrics,
+				metricsEntry.Metrics,
+			)
+			stats.CPUMeasured = true
+		}
 		containers = append(
 			containers,
 			Container{
 				Handle: handle,
-				Stats: Stats{
-					Memory: memory,
-					Age:    metricsEntry.Metrics.Age,
-				},
+				Stats:  stats,
 			},
 		)
 	}
+	if options.OpenFiles {
+		countOpenFiles(connection, containers)
+	}
 	return containers, nil
 }
 
+// openFilesConcurrency is how many containers have their open files counted
+// at once, so that a busy worker isn't asked to start a shell in all of them
+// together.
+const openFilesConcurrency = 8
+
+// countOpenFiles counts the open files of each container, a few at a time.
+// Containers without a shell can't be inspected, which shouldn't stop the
+// rest from being accounted for, so their count is left unknown.
+func countOpenFiles(connection GardenConnection, containers []Container) {
+	slots := make(chan struct{}, openFilesConcurrency)
+	var wg sync.WaitGroup
+	for i := range containers {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(stats *Stats, handle string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			stats.OpenFiles, stats.OpenFilesError = connection.OpenFiles(handle)
+			stats.OpenFilesMeasured = stats.OpenFilesError == nil
+		}(&containers[i].Stats, containers[i].Handle)
+	}
+	wg.Wait()
+}
+
+// garden reports CPU usage in nanoseconds, and the container's age lets us
+// tell how much wall clock time passed between the two samples.
+func cpuUtilisation(earlier, later garden.Metrics) float64 {
+	elapsed := later.Age - earlier.Age
+	if elapsed <= 0 || later.CPUStat.Usage < earlier.CPUStat.Usage {
+		return 0
+	}
+	used := later.CPUStat.Usage - earlier.CPUStat.Usage
+	return 100 * float64(used) / float64(elapsed.Nanoseconds())
+}
+
 type GardenDialer interface {
 	Dial() (net.Conn, error)
 }
 
-type LANGardenDialer struct{}
+// a LANGardenDialer reaches Garden at GardenAddr, which is either host:port
+// or the absolute path of a unix socket. It defaults to 127.0.0.1:7777.
+type LANGardenDialer struct {
+	GardenAddr string
+}
 
 func (lgd *LANGardenDialer) Dial() (net.Conn, error) {
-	return net.Dial("tcp", "127.0.0.1:7777")
+	network, addr := gardenNetworkAddr(lgd.GardenAddr)
+	return net.Dial(network, addr)
+}
+
+func gardenNetworkAddr(gardenAddr string) (string, string) {
+	if gardenAddr == "" {
+		return "tcp", "127.0.0.1:7777"
+	}
+	if strings.HasPrefix(gardenAddr, "/") {
+		return "unix", gardenAddr
+	}
+	return "tcp", gardenAddr
 }
 
 type K8sGardenDialer struct {
 	RESTConfig *rest.Config
 	Namespace  string
 	PodName    string
+	// GardenPort is the port Garden listens on inside the pod, 7777 if unset.
+	GardenPort string
 }
 
 func (kgd *K8sGardenDialer) Dial() (net.Conn, error) {
+	port := kgd.GardenPort
+	if port == "" {
+		port = "7777"
+	}
+	return kgd.DialPort(port)
+}
+
+// DialPort forwards a connection to any port in the pod.
+func (kgd *K8sGardenDialer) DialPort(port string) (net.Conn, error) {
 	transport, upgrader, err := spdy.RoundTripperFor(kgd.RESTConfig)
 	if err != nil {
 		return nil, err
@@ -110,7 +243,7 @@ func (kgd *K8sGardenDialer) Dial() (net.Conn, error) {
 	}
 	headers := http.Header{}
 	headers.Set(v1.StreamType, v1.StreamTypeData)
-	headers.Set(v1.PortHeader, "7777")
+	headers.Set(v1.PortHeader, port)
 	headers.Set(v1.PortForwardRequestIDHeader, "0")
 	stream, err := streamConn.CreateStream(headers)
 	if err != nil {
@@ -119,7 +252,11 @@ func (kgd *K8sGardenDialer) Dial() (net.Conn, error) {
 
 	headers.Set(v1.StreamType, v1.StreamTypeError)
 	streamConn.CreateStream(headers)
-	return &StreamConn{streamConn, stream}, nil
+	return &StreamConn{
+		conn:   streamConn,
+		stream: stream,
+		addr:   &StreamAddr{Addr: net.JoinHostPort(kgd.PodName, port)},
+	}, nil
 }
 
 func RESTConfig() (*rest.Config, error) {
@@ -139,9 +276,12 @@ func RESTConfig() (*rest.Config, error) {
 type StreamConn struct {
 	conn   httpstream.Connection
 	stream httpstream.Stream
+	addr   *StreamAddr
 }
 
+// a StreamAddr is the pod and port a StreamConn is forwarded to.
 type StreamAddr struct {
+	Addr string
 }
 
 func (sa *StreamAddr) Network() string {
@@ -149,7 +289,7 @@ func (sa *StreamAddr) Network() string {
 }
 
 func (sa *StreamAddr) String() string {
-	return "127.0.0.1:7777"
+	return sa.Addr
 }
 
 func (sc *StreamConn) Write(p []byte) (n int, err error) {
@@ -165,11 +305,11 @@ func (sc *StreamConn) Close() error {
 }
 
 func (sc *StreamConn) LocalAddr() net.Addr {
-	return &StreamAddr{}
+	return sc.addr
 }
 
 func (sc *StreamConn) RemoteAddr() net.Addr {
-	return &StreamAddr{}
+	return sc.addr
 }
 
 func (sc *StreamConn) SetDeadline(t time.Time) error {
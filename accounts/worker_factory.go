@@ -1,23 +1,155 @@
 package accounts
 
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
 type WorkerFactory func(Command) (Worker, error)
 
 var DefaultWorkerFactory WorkerFactory = func(cmd Command) (Worker, error) {
-	var dialer GardenDialer
+	if cmd.AllWorkers {
+		opener, err := postgresOpener(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &WorkerPool{
+			Lister: &ATCWorkerLister{Opener: opener},
+		}, nil
+	}
+	if cmd.K8sNamespace != "" && cmd.K8sSelector != "" {
+		restConfig, err := RESTConfig()
+		if err != nil {
+			return nil, err
+		}
+		return &WorkerPool{
+			Lister: &K8sPodWorkerLister{
+				Client:     NewK8sClient(restConfig, cmd.K8sNamespace),
+				RESTConfig: restConfig,
+				Namespace:  cmd.K8sNamespace,
+				Selector:   cmd.K8sSelector,
+				GardenPort: gardenPort(cmd),
+			},
+		}, nil
+	}
+	dialer, err := workerDialer(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &GardenWorker{
+		Dialer: dialer,
+	}, nil
+}
+
+func workerDialer(cmd Command) (GardenDialer, error) {
+	if cmd.WorkerName != "" {
+		opener, err := postgresOpener(cmd)
+		if err != nil {
+			return nil, err
+		}
+		dialer := &ForwardedWorkerDialer{
+			Opener:     opener,
+			WorkerName: cmd.WorkerName,
+		}
+		if webK8s(cmd) {
+			restConfig, err := RESTConfig()
+			if err != nil {
+				return nil, err
+			}
+			client := NewK8sClient(restConfig, cmd.WebK8sNamespace)
+			dialer.Web = &K8sWebPodDialer{
+				RESTConfig: restConfig,
+				Namespace:  cmd.WebK8sNamespace,
+				Pods: func() ([]corev1.Pod, error) {
+					return webK8sPods(cmd, client)
+				},
+			}
+		}
+		return dialer, nil
+	}
+	if cmd.BoshDeployment != "" && cmd.BoshInstance != "" {
+		instance, err := ParseBoshInstance(cmd.BoshDeployment, cmd.BoshInstance, cmd.BoshNetwork)
+		if err != nil {
+			return nil, err
+		}
+		gateway, config, err := boshSSH(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return &BoshGardenDialer{
+			Gateway:    gateway,
+			Instance:   instance,
+			Config:     config,
+			GardenAddr: cmd.GardenAddr,
+		}, nil
+	}
+	if cmd.SSHHost != "" {
+		hostKeys, err := NewHostKeyCallback(cmd.KnownHosts, cmd.InsecureHostKeys)
+		if err != nil {
+			return nil, err
+		}
+		var config *ssh.ClientConfig
+		if cmd.SSHKey != "" {
+			config, err = NewSSHClientConfig(cmd.SSHUser, cmd.SSHKey, hostKeys)
+		} else {
+			config, err = NewSSHAgentClientConfig(cmd.SSHUser, os.Getenv("SSH_AUTH_SOCK"), hostKeys)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &SSHGardenDialer{
+			Hop:        SSHHop{Addr: sshAddr(cmd.SSHHost), Config: config},
+			GardenAddr: cmd.GardenAddr,
+		}, nil
+	}
 	if cmd.K8sNamespace != "" && cmd.K8sPod != "" {
 		restConfig, err := RESTConfig()
 		if err != nil {
 			return nil, err
 		}
-		dialer = &K8sGardenDialer{
+		return &K8sGardenDialer{
 			RESTConfig: restConfig,
 			Namespace:  cmd.K8sNamespace,
 			PodName:    cmd.K8sPod,
-		}
-	} else {
-		dialer = &LANGardenDialer{}
+			GardenPort: gardenPort(cmd),
+		}, nil
 	}
-	return &GardenWorker{
-		Dialer: dialer,
+	return &LANGardenDialer{
+		GardenAddr: cmd.GardenAddr,
 	}, nil
 }
+
+// gardenPort leaves the port to K8sGardenDialer's default when it isn't set.
+func gardenPort(cmd Command) string {
+	if cmd.GardenPort == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(cmd.GardenPort))
+}
+
+// boshSSH signs in to the gateway and, once through it, to BOSH instances.
+func boshSSH(cmd Command) (SSHHop, *ssh.ClientConfig, error) {
+	hostKeys, err := NewHostKeyCallback(cmd.KnownHosts, cmd.InsecureHostKeys)
+	if err != nil {
+		return SSHHop{}, nil, err
+	}
+	gatewayConfig, err := NewSSHClientConfig(cmd.BoshGatewayUser, cmd.BoshGatewayKey, hostKeys)
+	if err != nil {
+		return SSHHop{}, nil, err
+	}
+	instanceKey := cmd.BoshKey
+	if instanceKey == "" {
+		instanceKey = cmd.BoshGatewayKey
+	}
+	instanceConfig, err := NewSSHClientConfig(cmd.BoshUser, instanceKey, hostKeys)
+	if err != nil {
+		return SSHHop{}, nil, err
+	}
+	return SSHHop{
+		Addr:   sshAddr(cmd.BoshGatewayHost),
+		Config: gatewayConfig,
+	}, instanceConfig, nil
+}
@@ -0,0 +1,224 @@
+package accounts
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/concourse/concourse/atc/db"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+type NamedWorker struct {
+	Name   string
+	Worker Worker
+}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . WorkerLister
+
+type WorkerLister interface {
+	Workers() ([]NamedWorker, error)
+}
+
+// WorkerErrors are the failures of individual workers in a WorkerPool, by
+// worker name.
+type WorkerErrors map[string]error
+
+func (we WorkerErrors) Error() string {
+	messages := []string{}
+	for _, name := range we.Names() {
+		messages = append(messages, fmt.Sprintf("%s: %s", name, we[name]))
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (we WorkerErrors) Names() []string {
+	names := []string{}
+	for name := range we {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// a WorkerSet knows which workers answered the last time their containers
+// were listed, including those which had none.
+type WorkerSet interface {
+	AnsweredWorkers() []string
+}
+
+// a WorkerPool lists the containers on every worker its Lister finds, all at
+// once, and labels each container with its worker's name. When some workers
+// fail, the containers from the rest are returned along with WorkerErrors.
+type WorkerPool struct {
+	Lister WorkerLister
+
+	lock     sync.Mutex
+	answered []string
+}
+
+// AnsweredWorkers names the workers whose containers were listed by the last
+// call to Containers, in order.
+func (wp *WorkerPool) AnsweredWorkers() []string {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	return wp.answered
+}
+
+func (wp *WorkerPool) Containers(opts ...StatsOption) ([]Container, error) {
+	workers, err := wp.Lister.Workers()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		wg           sync.WaitGroup
+		mutex        sync.Mutex
+		containers   = []Container{}
+		answered     = []string{}
+		workerErrors = WorkerErrors{}
+	)
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w NamedWorker) {
+			defer wg.Done()
+			workerContainers, err := w.Worker.Containers(opts...)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				workerErrors[w.Name] = err
+				return
+			}
+			answered = append(answered, w.Name)
+			for _, container := range workerContainers {
+				container.Worker = w.Name
+				containers = append(containers, container)
+			}
+		}(w)
+	}
+	wg.Wait()
+	sort.Strings(answered)
+	wp.lock.Lock()
+	wp.answered = answered
+	wp.lock.Unlock()
+	if len(workerErrors) > 0 {
+		return containers, workerErrors
+	}
+	return containers, nil
+}
+
+// an ATCWorkerLister finds the running workers registered in the ATC
+// database, to be reached at the addresses they registered with.
+type ATCWorkerLister struct {
+	Opener PostgresOpener
+}
+
+func (awl *ATCWorkerLister) Workers() ([]NamedWorker, error) {
+	conn, err := awl.Opener.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	registered, err := registeredWorkers(conn, sq.Eq{"w.state": "running"})
+	if err != nil {
+		return nil, err
+	}
+	workers := []NamedWorker{}
+	for _, rw := range registered {
+		workers = append(workers, NamedWorker{
+			Name: rw.Name,
+			Worker: &GardenWorker{
+				Dialer: &AddrDialer{GardenAddr: rw.GardenAddr},
+			},
+		})
+	}
+	return workers, nil
+}
+
+// a K8sPodWorkerLister finds the running worker pods matching a label
+// selector, to be reached by port-forwarding.
+type K8sPodWorkerLister struct {
+	Client     K8sClient
+	RESTConfig *rest.Config
+	Namespace  string
+	Selector   string
+	GardenPort string
+}
+
+func (kpwl *K8sPodWorkerLister) Workers() ([]NamedWorker, error) {
+	pods, err := kpwl.Client.ListPods(kpwl.Selector)
+	if err != nil {
+		return nil, err
+	}
+	workers := []NamedWorker{}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		workers = append(workers, NamedWorker{
+			Name: pod.Name,
+			Worker: &GardenWorker{
+				Dialer: &K8sGardenDialer{
+					RESTConfig: kpwl.RESTConfig,
+					Namespace:  kpwl.Namespace,
+					PodName:    pod.Name,
+					GardenPort: kpwl.GardenPort,
+				},
+			},
+		})
+	}
+	return workers, nil
+}
+
+// a RegisteredWorker is a worker as the ATC knows about it.
+type RegisteredWorker struct {
+	Name       string
+	State      string
+	GardenAddr string
+}
+
+func registeredWorkers(conn *sql.DB, where sq.Sqlizer) ([]RegisteredWorker, error) {
+	rows, err := sq.StatementBuilder.
+		PlaceholderFormat(sq.Dollar).
+		Select("w.name", "w.state", "w.addr").
+		From("workers w").
+		Where(where).
+		OrderBy("w.name").
+		RunWith(conn).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := []RegisteredWorker{}
+	defer db.Close(rows)
+	for rows.Next() {
+		var (
+			worker RegisteredWorker
+			addr   sql.NullString
+		)
+		err = rows.Scan(&worker.Name, &worker.State, &addr)
+		if err != nil {
+			return nil, err
+		}
+		worker.GardenAddr = addr.String
+		workers = append(workers, worker)
+	}
+	return workers, nil
+}
+
+// an AddrDialer reaches a worker's Garden directly at the given address.
+type AddrDialer struct {
+	GardenAddr string
+}
+
+func (ad *AddrDialer) Dial() (net.Conn, error) {
+	if ad.GardenAddr == "" {
+		return nil, fmt.Errorf("worker has no garden address")
+	}
+	return net.Dial("tcp", ad.GardenAddr)
+}
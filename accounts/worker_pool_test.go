@@ -0,0 +1,180 @@
+package accounts_test
+
+import (
+	"errors"
+	"net"
+	"sort"
+
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/garden/gardenfakes"
+	"code.cloudfoundry.org/garden/server"
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/concourse/ft/accounts"
+	"github.com/concourse/ft/accounts/accountsfakes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+type WorkerPoolSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func (s *WorkerPoolSuite) TestMergesContainersFromEveryWorker() {
+	worker1 := new(accountsfakes.FakeWorker)
+	worker1.ContainersReturns([]accounts.Container{{Handle: "a"}}, nil)
+	worker2 := new(accountsfakes.FakeWorker)
+	worker2.ContainersReturns([]accounts.Container{{Handle: "b"}, {Handle: "c"}}, nil)
+	lister := new(accountsfakes.FakeWorkerLister)
+	lister.WorkersReturns([]accounts.NamedWorker{
+		{Name: "worker-1", Worker: worker1},
+		{Name: "worker-2", Worker: worker2},
+	}, nil)
+	pool := &accounts.WorkerPool{Lister: lister}
+
+	containers, err := pool.Containers(accounts.WithOpenFiles())
+
+	s.NoError(err)
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Handle < containers[j].Handle
+	})
+	s.Equal([]accounts.Container{
+		{Handle: "a", Worker: "worker-1"},
+		{Handle: "b", Worker: "worker-2"},
+		{Handle: "c", Worker: "worker-2"},
+	}, containers)
+	s.Len(worker1.ContainersArgsForCall(0), 1)
+}
+
+func (s *WorkerPoolSuite) TestNamesTheWorkersWhichAnswered() {
+	empty := new(accountsfakes.FakeWorker)
+	empty.ContainersReturns([]accounts.Container{}, nil)
+	busy := new(accountsfakes.FakeWorker)
+	busy.ContainersReturns([]accounts.Container{{Handle: "a"}}, nil)
+	broken := new(accountsfakes.FakeWorker)
+	broken.ContainersReturns(nil, errors.New("connection refused"))
+	lister := new(accountsfakes.FakeWorkerLister)
+	lister.WorkersReturns([]accounts.NamedWorker{
+		{Name: "empty", Worker: empty},
+		{Name: "busy", Worker: busy},
+		{Name: "broken", Worker: broken},
+	}, nil)
+	pool := &accounts.WorkerPool{Lister: lister}
+
+	pool.Containers()
+
+	s.Equal([]string{"busy", "empty"}, pool.AnsweredWorkers())
+}
+
+func (s *WorkerPoolSuite) TestReportsFailuresPerWorker() {
+	healthy := new(accountsfakes.FakeWorker)
+	healthy.ContainersReturns([]accounts.Container{{Handle: "a"}}, nil)
+	broken := new(accountsfakes.FakeWorker)
+	broken.ContainersReturns(nil, errors.New("connection refused"))
+	lister := new(accountsfakes.FakeWorkerLister)
+	lister.WorkersReturns([]accounts.NamedWorker{
+		{Name: "healthy", Worker: healthy},
+		{Name: "broken", Worker: broken},
+	}, nil)
+	pool := &accounts.WorkerPool{Lister: lister}
+
+	containers, err := pool.Containers()
+
+	s.Equal([]accounts.Container{{Handle: "a", Worker: "healthy"}}, containers)
+	s.Equal(
+		accounts.WorkerErrors{"broken": errors.New("connection refused")},
+		err,
+	)
+	s.EqualError(err, "broken: connection refused")
+}
+
+func (s *WorkerPoolSuite) TestFailsWhenWorkersCannotBeListed() {
+	lister := new(accountsfakes.FakeWorkerLister)
+	lister.WorkersReturns(nil, errors.New("db down"))
+	pool := &accounts.WorkerPool{Lister: lister}
+
+	_, err := pool.Containers()
+
+	s.EqualError(err, "db down")
+}
+
+func (s *WorkerPoolSuite) TestAddrDialerReachesGarden() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	backend := new(gardenfakes.FakeBackend)
+	backend.ContainersReturns([]garden.Container{}, nil)
+	gardenServer := server.New(
+		"tcp",
+		listener.Addr().String(),
+		0,
+		backend,
+		lagertest.NewTestLogger("test"),
+	)
+	go gardenServer.Serve(listener)
+	defer gardenServer.Stop()
+	worker := &accounts.GardenWorker{
+		Dialer: &accounts.AddrDialer{GardenAddr: listener.Addr().String()},
+	}
+
+	containers, err := worker.Containers()
+
+	s.NoError(err)
+	s.Empty(containers)
+}
+
+func (s *WorkerPoolSuite) TestAddrDialerNeedsAnAddress() {
+	_, err := (&accounts.AddrDialer{}).Dial()
+
+	s.EqualError(err, "worker has no garden address")
+}
+
+func (s *WorkerPoolSuite) TestListsRunningWorkerPods() {
+	pod := func(name string, phase corev1.PodPhase) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	restConfig := &rest.Config{}
+	lister := &accounts.K8sPodWorkerLister{
+		Client: &testk8sClient{
+			pods: []corev1.Pod{
+				pod("worker-0", corev1.PodRunning),
+				pod("worker-1", corev1.PodPending),
+				pod("worker-2", corev1.PodRunning),
+			},
+		},
+		RESTConfig: restConfig,
+		Namespace:  "ci",
+		Selector:   "app=concourse-worker",
+	}
+
+	workers, err := lister.Workers()
+
+	s.NoError(err)
+	s.Equal([]accounts.NamedWorker{
+		{
+			Name: "worker-0",
+			Worker: &accounts.GardenWorker{
+				Dialer: &accounts.K8sGardenDialer{
+					RESTConfig: restConfig,
+					Namespace:  "ci",
+					PodName:    "worker-0",
+				},
+			},
+		},
+		{
+			Name: "worker-2",
+			Worker: &accounts.GardenWorker{
+				Dialer: &accounts.K8sGardenDialer{
+					RESTConfig: restConfig,
+					Namespace:  "ci",
+					PodName:    "worker-2",
+				},
+			},
+		},
+	}, workers)
+}
@@ -2,11 +2,17 @@ package accounts_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/garden"
@@ -62,6 +68,57 @@ func (s *LANWorkerSuite) TestLANWorkerListsContainers() {
 	s.Equal(s.backend.ContainersCallCount(), 1)
 }
 
+func (s *LANWorkerSuite) TestLANWorkerDialsConfiguredAddr() {
+	backend := new(gardenfakes.FakeBackend)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.NoError(err)
+	gardenServer := server.New(
+		"tcp",
+		listener.Addr().String(),
+		0,
+		backend,
+		lagertest.NewTestLogger("test"),
+	)
+	go gardenServer.Serve(listener)
+	defer gardenServer.Stop()
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{GardenAddr: listener.Addr().String()},
+	}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, backend.ContainersCallCount())
+	s.Equal(0, s.backend.ContainersCallCount())
+}
+
+func (s *LANWorkerSuite) TestLANWorkerDialsUnixSockets() {
+	dir, err := ioutil.TempDir("", "ft-garden")
+	s.NoError(err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "garden.sock")
+	backend := new(gardenfakes.FakeBackend)
+	listener, err := net.Listen("unix", socket)
+	s.NoError(err)
+	gardenServer := server.New(
+		"unix",
+		socket,
+		0,
+		backend,
+		lagertest.NewTestLogger("test"),
+	)
+	go gardenServer.Serve(listener)
+	defer gardenServer.Stop()
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{GardenAddr: socket},
+	}
+
+	_, err = worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, backend.ContainersCallCount())
+}
+
 func (s *LANWorkerSuite) TestLANWorkerGetsMemory() {
 	s.backend.BulkMetricsReturns(map[string]garden.ContainerMetricsEntry{
 		"container-handle": garden.ContainerMetricsEntry{
@@ -87,6 +144,172 @@ func (s *LANWorkerSuite) TestLANWorkerGetsMemory() {
 	s.Equal(uint64(60), containers[0].Stats.Memory)
 }
 
+func (s *LANWorkerSuite) TestLANWorkerMeasuresCPUUtilisation() {
+	metrics := func(age time.Duration, usage uint64) map[string]garden.ContainerMetricsEntry {
+		return map[string]garden.ContainerMetricsEntry{
+			"container-handle": garden.ContainerMetricsEntry{
+				Metrics: garden.Metrics{
+					Age:     age,
+					CPUStat: garden.ContainerCPUStat{Usage: usage},
+				},
+			},
+		}
+	}
+	s.backend.BulkMetricsReturnsOnCall(
+		0,
+		metrics(10*time.Second, uint64(2*time.Second)),
+		nil,
+	)
+	s.backend.BulkMetricsReturnsOnCall(
+		1,
+		metrics(12*time.Second, uint64(3*time.Second)),
+		nil,
+	)
+
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{},
+	}
+	containers, err := worker.Containers(
+		accounts.WithCPUInterval(time.Millisecond),
+	)
+
+	s.NoError(err)
+	s.Equal(2, s.backend.BulkMetricsCallCount())
+	s.Len(containers, 1)
+	s.Equal(3*time.Second, containers[0].Stats.CPUTime)
+	s.Equal(50.0, containers[0].Stats.CPUPercent)
+	s.True(containers[0].Stats.CPUMeasured)
+}
+
+func (s *LANWorkerSuite) TestLANWorkerSkipsCPUUtilisationWithoutInterval() {
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{},
+	}
+	containers, err := worker.Containers()
+
+	s.NoError(err)
+	s.Equal(1, s.backend.BulkMetricsCallCount())
+	for _, container := range containers {
+		s.False(container.Stats.CPUMeasured)
+	}
+}
+
+func (s *LANWorkerSuite) TestLANWorkerCountsProcesses() {
+	s.backend.BulkMetricsReturns(map[string]garden.ContainerMetricsEntry{
+		"container-handle": garden.ContainerMetricsEntry{
+			Metrics: garden.Metrics{
+				PidStat: garden.ContainerPidStat{Current: 7},
+			},
+		},
+	}, nil)
+
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{},
+	}
+	containers, err := worker.Containers()
+
+	s.NoError(err)
+	s.Len(containers, 1)
+	s.Equal(uint64(7), containers[0].Stats.Processes)
+}
+
+func (s *LANWorkerSuite) TestLANWorkerCountsOpenFiles() {
+	s.backend.BulkMetricsReturns(map[string]garden.ContainerMetricsEntry{
+		"container-handle": garden.ContainerMetricsEntry{},
+	}, nil)
+	fakeContainer := new(gardenfakes.FakeContainer)
+	fakeContainer.RunStub = func(spec garden.ProcessSpec, pio garden.ProcessIO) (garden.Process, error) {
+		fakeProcess := new(gardenfakes.FakeProcess)
+		fakeProcess.WaitStub = func() (int, error) {
+			io.WriteString(pio.Stdout, "42\n")
+			return 0, nil
+		}
+		return fakeProcess, nil
+	}
+	s.backend.LookupReturns(fakeContainer, nil)
+	s.NoError(s.gardenServer.SetupBomberman())
+
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{},
+	}
+	containers, err := worker.Containers(accounts.WithOpenFiles())
+
+	s.NoError(err)
+	s.Len(containers, 1)
+	s.Equal(uint64(42), containers[0].Stats.OpenFiles)
+	s.True(containers[0].Stats.OpenFilesMeasured)
+	spec, _ := fakeContainer.RunArgsForCall(0)
+	s.Equal("sh", spec.Path)
+	s.Equal("root", spec.User)
+}
+
+func (s *LANWorkerSuite) TestLANWorkerToleratesContainersWithoutAShell() {
+	s.backend.BulkMetricsReturns(map[string]garden.ContainerMetricsEntry{
+		"container-handle": garden.ContainerMetricsEntry{},
+	}, nil)
+	fakeContainer := new(gardenfakes.FakeContainer)
+	fakeContainer.RunReturns(nil, errors.New("sh: not found"))
+	s.backend.LookupReturns(fakeContainer, nil)
+	s.NoError(s.gardenServer.SetupBomberman())
+
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{},
+	}
+	containers, err := worker.Containers(accounts.WithOpenFiles())
+
+	s.NoError(err)
+	s.Len(containers, 1)
+	s.Zero(containers[0].Stats.OpenFiles)
+	s.False(containers[0].Stats.OpenFilesMeasured)
+	s.Error(containers[0].Stats.OpenFilesError)
+}
+
+func (s *LANWorkerSuite) TestLANWorkerCountsOpenFilesConcurrently() {
+	metrics := map[string]garden.ContainerMetricsEntry{}
+	for i := 0; i < 20; i++ {
+		metrics[fmt.Sprintf("container-%d", i)] = garden.ContainerMetricsEntry{}
+	}
+	s.backend.BulkMetricsReturns(metrics, nil)
+	var (
+		lock                sync.Mutex
+		running, mostAtOnce int
+	)
+	fakeContainer := new(gardenfakes.FakeContainer)
+	fakeContainer.RunStub = func(spec garden.ProcessSpec, pio garden.ProcessIO) (garden.Process, error) {
+		fakeProcess := new(gardenfakes.FakeProcess)
+		fakeProcess.WaitStub = func() (int, error) {
+			lock.Lock()
+			running++
+			if running > mostAtOnce {
+				mostAtOnce = running
+			}
+			lock.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+			io.WriteString(pio.Stdout, "42\n")
+			return 0, nil
+		}
+		return fakeProcess, nil
+	}
+	s.backend.LookupReturns(fakeContainer, nil)
+	s.NoError(s.gardenServer.SetupBomberman())
+
+	worker := accounts.GardenWorker{
+		Dialer: &accounts.LANGardenDialer{},
+	}
+	containers, err := worker.Containers(accounts.WithOpenFiles())
+
+	s.NoError(err)
+	s.Len(containers, 20)
+	for _, container := range containers {
+		s.Equal(uint64(42), container.Stats.OpenFiles)
+	}
+	s.True(mostAtOnce > 1, "counted one container at a time")
+	s.True(mostAtOnce <= 8, "counted %d containers at once", mostAtOnce)
+}
+
 type K8sGardenDialerSuite struct {
 	suite.Suite
 	*require.Assertions
@@ -132,6 +355,42 @@ func (s *K8sGardenDialerSuite) TestConnectsToForwardedPort() {
 	)
 }
 
+func (s *K8sGardenDialerSuite) TestForwardsConfiguredGardenPort() {
+	streamingServer, err := s.newTestStreamingServer()
+	s.NoError(err)
+	forwardedPorts := make(chan int32, 1)
+	streamingServer.fakeRuntime.PortForwardCalls(func(
+		pod string,
+		port int32,
+		conn io.ReadWriteCloser,
+	) error {
+		forwardedPorts <- port
+		return nil
+	})
+
+	dialer := &accounts.K8sGardenDialer{
+		RESTConfig: &restclient.Config{
+			Host:    streamingServer.testHTTPServer.URL,
+			APIPath: "/api",
+			ContentConfig: restclient.ContentConfig{
+				NegotiatedSerializer: scheme.Codecs,
+				ContentType:          runtime.ContentTypeJSON,
+				GroupVersion:         &corev1.SchemeGroupVersion,
+			},
+		},
+		Namespace:  "some-namespace",
+		PodName:    "some-pod",
+		GardenPort: "7000",
+	}
+	conn, err := dialer.Dial()
+
+	s.NoError(err)
+	s.Equal("some-pod:7000", conn.RemoteAddr().String())
+	conn.Write([]byte("hello world"))
+	conn.Close()
+	s.Equal(int32(7000), <-forwardedPorts)
+}
+
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 k8s.io/kubernetes/pkg/kubelet/server/streaming.Runtime
 
 type testStreamingServer struct {